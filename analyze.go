@@ -1,29 +1,152 @@
 package k6exec
 
 import (
+	"context"
+	"io"
 	"log/slog"
 	"os"
-	"strings"
 
 	"github.com/grafana/k6deps"
 )
 
-func analyze(args []string, opts *Options) (k6deps.Dependencies, error) {
-	depsOpts := newDepsOptions(args, opts)
+// Origin identifies the kind of source a dependency was found in.
+type Origin string
+
+const (
+	// OriginPragma is a "use k6" pragma of the script.
+	OriginPragma Origin = "pragma"
+	// OriginImport is an import (or require) expression of the script.
+	OriginImport Origin = "import"
+	// OriginManifest is the dependencies property of the manifest file.
+	OriginManifest Origin = "manifest"
+	// OriginEnv is the environment variable containing the dependencies.
+	OriginEnv Origin = "env"
+	// OriginArchive is a k6 archive.
+	OriginArchive Origin = "archive"
+	// OriginOutput is an output extension used by the --out flag or the K6_OUT environment variable.
+	OriginOutput Origin = "output"
+)
+
+// DependencySource describes the version constraints of a dependency found in a source.
+type DependencySource struct {
+	// Origin contains the kind of the source.
+	Origin Origin `json:"origin"`
+	// Name contains the name of the source (file, environment variable or flag).
+	Name string `json:"name,omitempty"`
+	// Constraints contains the version constraints found in the source.
+	Constraints string `json:"constraints"`
+}
+
+// Analysis contains the result of the dependency analysis.
+type Analysis struct {
+	// Dependencies contains the dependencies merged from all sources.
+	Dependencies k6deps.Dependencies
+	// Sources contains the sources of the dependencies, indexed by dependency name.
+	Sources map[string][]DependencySource
+
+	stdin    []byte
+	manifest string
+	script   string
+	// scripted is true if a script (or an archive) was analyzed.
+	scripted bool
+}
+
+// Analyze analyzes the dependencies of the given k6 command line the same way Command does,
+// without provisioning the k6 executable.
+// If the script argument is "-", the script is read from Options.Stdin (or the standard input).
+func Analyze(ctx context.Context, args []string, opts *Options) (*Analysis, error) {
+	parsed, err := ParseArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, release, err := withNetworkConfig(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
 
-	// we call Analyze before logging because it will return the name of the manifest, in any
-	deps, err := k6deps.Analyze(depsOpts)
+	var stdin []byte
+
+	if parsed.Script == StdinScript {
+		if stdin, err = io.ReadAll(opts.stdin()); err != nil {
+			return nil, err
+		}
+	}
+
+	return analyze(ctx, parsed, stdin, opts)
+}
+
+func analyze(ctx context.Context, args *Args, stdin []byte, opts *Options) (*Analysis, error) {
+	depsOpts, closer, err := newDepsOptions(ctx, args, stdin, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closer() //nolint:errcheck
+
+	// we analyze the sources before logging because it will set the name of the manifest, if any
+	sources, err := analyzeSources(depsOpts)
 
 	slog.Debug("analyzing sources", depsOptsAttrs(depsOpts)...)
 
-	if err == nil && len(deps) > 0 {
-		slog.Debug("found dependencies", "deps", deps.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if args.HasScript() {
+		outputs, err := analyzeOutputs(ctx, args, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, outputs...)
+	}
+
+	policy, err := ParseMergePolicy(string(opts.MergePolicy))
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := &Analysis{
+		Dependencies: make(k6deps.Dependencies),
+		Sources:      make(map[string][]DependencySource),
+		stdin:        stdin,
+		manifest:     depsOpts.Manifest.Name,
+		scripted:     args.HasScript(),
+	}
+
+	if args.HasScript() && args.Script != StdinScript && !isRemoteScript(args.Script) {
+		analysis.script = args.Script
 	}
 
-	return deps, err
+	for _, src := range sources {
+		// sources are collected before merging, as merging can update the source dependencies
+		for name, found := range src.dependencySources() {
+			analysis.Sources[name] = append(analysis.Sources[name], found...)
+		}
+
+		if err := policy.merge(analysis.Dependencies, src.deps); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(analysis.Dependencies) > 0 {
+		slog.Debug("found dependencies", "merge policy", policy, "deps", analysis.Dependencies.String())
+	}
+
+	return analysis, nil
 }
 
-func newDepsOptions(args []string, opts *Options) *k6deps.Options {
+// newDepsOptions returns the options of the dependency analysis for the given arguments.
+// The returned function must be called to release the sources after the analysis.
+func newDepsOptions(
+	ctx context.Context,
+	args *Args,
+	stdin []byte,
+	opts *Options,
+) (*k6deps.Options, func() error, error) {
 	dopts := &k6deps.Options{
 		Env:          opts.Env,
 		Manifest:     opts.Manifest,
@@ -31,44 +154,35 @@ func newDepsOptions(args []string, opts *Options) *k6deps.Options {
 		FindManifest: opts.FindManifest,
 	}
 
-	scriptname, hasScript := scriptArg(args)
-	if !hasScript {
-		return dopts
+	if !args.HasScript() {
+		return dopts, nopCloser, nil
 	}
 
-	if _, err := os.Stat(scriptname); err != nil { //nolint:forbidigo
-		return dopts
-	}
+	scriptname := args.Script
 
-	if strings.HasSuffix(scriptname, ".tar") {
-		dopts.Archive.Name = scriptname
-	} else {
-		dopts.Script.Name = scriptname
+	if scriptname == StdinScript {
+		return dopts, nopCloser, setContent(dopts, scriptname, stdin)
 	}
 
-	return dopts
-}
-
-func scriptArg(args []string) (string, bool) {
-	if len(args) == 0 {
-		return "", false
-	}
+	if isRemoteScript(scriptname) {
+		content, err := fetchScript(ctx, scriptname, opts)
+		if err != nil {
+			return nil, nil, err
+		}
 
-	cmd := args[0]
-	if cmd != "run" && cmd != "archive" && cmd != "inspect" && cmd != "cloud" {
-		return "", false
+		return dopts, nopCloser, setContent(dopts, scriptname, content)
 	}
 
-	if len(args) == 1 {
-		return "", false
+	if _, err := os.Stat(scriptname); err != nil { //nolint:forbidigo
+		return dopts, nopCloser, nil
 	}
 
-	last := args[len(args)-1]
-	if last[0] == '-' {
-		return "", false
+	closer, err := setFile(dopts, scriptname)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return last, true
+	return dopts, closer, nil
 }
 
 func depsOptsAttrs(opts *k6deps.Options) []any {
@@ -0,0 +1,141 @@
+package k6exec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_analyze_stdin(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{
+		Env:      k6deps.Source{Ignore: true},
+		Manifest: k6deps.Source{Ignore: true},
+	}
+
+	args, err := ParseArgs([]string{"run", "-"})
+	require.NoError(t, err)
+
+	script := []byte(`"use k6 with k6/x/faker > 0.4.0";` + "\nexport default function() {}\n")
+
+	analysis, err := analyze(context.Background(), args, script, opts)
+	require.NoError(t, err)
+	require.Contains(t, analysis.Dependencies, "k6/x/faker")
+	require.Equal(t, ">0.4.0", analysis.Dependencies["k6/x/faker"].GetConstraints().String())
+	require.Equal(t, script, analysis.stdin)
+
+	archive, err := os.ReadFile(filepath.Join("cmd", "testdata", "archive.tar")) //nolint:forbidigo
+	require.NoError(t, err)
+
+	analysis, err = analyze(context.Background(), args, archive, opts)
+	require.NoError(t, err)
+	require.Contains(t, analysis.Dependencies, "k6/x/faker")
+	require.Contains(t, analysis.Dependencies, "k6/x/sql")
+	require.Equal(t, OriginArchive, analysis.Sources["k6/x/faker"][0].Origin)
+}
+
+func Test_analyze_sources(t *testing.T) {
+	t.Parallel()
+
+	manifest := filepath.Join(t.TempDir(), "package.json")
+
+	err := os.WriteFile(manifest, []byte(`{"dependencies":{"k6/x/sql":">=1.0.1","k6/x/yaml":"*"}}`), 0o600) //nolint:forbidigo
+	require.NoError(t, err)
+
+	opts := &Options{
+		Env: k6deps.Source{Name: "DEPS"},
+		LookupEnv: func(key string) (string, bool) {
+			if key == "DEPS" {
+				return "k6>0.54;k6/x/faker>0.4.0", true
+			}
+
+			return "", false
+		},
+		FindManifest: func(string) (string, bool, error) {
+			return manifest, true, nil
+		},
+	}
+
+	args, err := ParseArgs([]string{"run", filepath.Join("examples", "combined.js")})
+	require.NoError(t, err)
+
+	analysis, err := analyze(context.Background(), args, nil, opts)
+	require.NoError(t, err)
+
+	script, err := filepath.Abs(filepath.Join("examples", "combined.js"))
+	require.NoError(t, err)
+
+	require.Equal(t, []DependencySource{
+		{Origin: OriginPragma, Name: script, Constraints: ">0.54"},
+		{Origin: OriginEnv, Name: "DEPS", Constraints: ">0.54"},
+	}, analysis.Sources["k6"])
+
+	require.Equal(t, []DependencySource{
+		{Origin: OriginPragma, Name: script, Constraints: ">0.4.0"},
+		{Origin: OriginImport, Name: script, Constraints: "*"},
+		{Origin: OriginEnv, Name: "DEPS", Constraints: ">0.4.0"},
+	}, analysis.Sources["k6/x/faker"])
+
+	require.Equal(t, []DependencySource{
+		{Origin: OriginPragma, Name: script, Constraints: ">=1.0.1"},
+		{Origin: OriginImport, Name: script, Constraints: "*"},
+		{Origin: OriginManifest, Name: manifest, Constraints: ">=1.0.1"},
+	}, analysis.Sources["k6/x/sql"])
+
+	require.Equal(t, []DependencySource{
+		{Origin: OriginManifest, Name: manifest, Constraints: "*"},
+	}, analysis.Sources["k6/x/yaml"])
+
+	require.Contains(t, analysis.Dependencies, "k6/x/yaml")
+	require.Equal(t, ">=1.0.1", analysis.Dependencies["k6/x/sql"].GetConstraints().String())
+}
+
+func Test_analyze_sources_script(t *testing.T) {
+	t.Parallel()
+
+	script := []byte(`"use k6 with k6/x/faker > 0.4.0";
+"use k6 >= 0.54";
+import faker from "k6/x/faker";
+const yaml = require("k6/x/yaml");
+// import sql from 'k6/x/sql';
+const pragma = "use k6 with k6/x/sql";
+`)
+
+	opts := &Options{Env: k6deps.Source{Ignore: true}, Manifest: k6deps.Source{Ignore: true}}
+
+	args, err := ParseArgs([]string{"run", StdinScript})
+	require.NoError(t, err)
+
+	analysis, err := analyze(context.Background(), args, script, opts)
+	require.NoError(t, err)
+
+	// the sources are found the same way as the dependencies
+	var deps k6deps.Dependencies
+
+	require.NoError(t, deps.UnmarshalJS(script))
+	require.Equal(t, deps.String(), analysis.Dependencies.String())
+	require.Len(t, analysis.Sources, len(deps))
+
+	require.Equal(t, []DependencySource{
+		{Origin: OriginPragma, Name: StdinScript, Constraints: ">=0.54"},
+	}, analysis.Sources["k6"])
+
+	require.Equal(t, []DependencySource{
+		{Origin: OriginPragma, Name: StdinScript, Constraints: ">0.4.0"},
+		{Origin: OriginImport, Name: StdinScript, Constraints: "*"},
+	}, analysis.Sources["k6/x/faker"])
+
+	require.Equal(t, []DependencySource{
+		{Origin: OriginImport, Name: StdinScript, Constraints: "*"},
+	}, analysis.Sources["k6/x/yaml"])
+
+	require.Equal(t, []DependencySource{
+		{Origin: OriginPragma, Name: StdinScript, Constraints: "*"},
+		{Origin: OriginImport, Name: StdinScript, Constraints: "*"},
+	}, analysis.Sources["k6/x/sql"])
+}
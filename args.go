@@ -0,0 +1,245 @@
+package k6exec
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidArgs is returned when the k6 command line cannot be parsed.
+var ErrInvalidArgs = errors.New("invalid arguments")
+
+// StdinScript is the script argument used to read the script from the standard input.
+const StdinScript = "-"
+
+// Args contains the result of parsing a k6 command line.
+type Args struct {
+	// Command contains the k6 command and its nested subcommand, if any (e.g. "cloud", "run").
+	Command []string
+	// Script contains the script (or archive) argument of the command.
+	// It is StdinScript if the script is read from the standard input.
+	Script string
+	// ScriptIndex contains the position of the script argument in the parsed arguments.
+	// It is -1 if the command has no script argument.
+	ScriptIndex int
+	// Flags contains the values of the flags, indexed by the long flag name without dashes.
+	// Flags without value (e.g. boolean flags) have an empty string value.
+	Flags map[string][]string
+}
+
+// HasScript returns true if the command has a script argument.
+func (a *Args) HasScript() bool {
+	return a.ScriptIndex >= 0
+}
+
+// Flag returns the last value of the given flag and true if the flag was present.
+func (a *Args) Flag(name string) (string, bool) {
+	values, found := a.Flags[name]
+	if !found || len(values) == 0 {
+		return "", false
+	}
+
+	return values[len(values)-1], true
+}
+
+// ParseArgs parses a k6 command line (without the executable name).
+// It knows which k6 flags take a value, handles the "--" separator,
+// the nested subcommands of the cloud command and the "-" script argument.
+// Unknown flags are assumed not to take a value. Since k6 commands accept a single script argument,
+// if more than one positional argument remains, the last one is taken as the script.
+func ParseArgs(args []string) (*Args, error) {
+	parsed := &Args{ScriptIndex: -1, Flags: make(map[string][]string)}
+	positionals := make([]int, 0, 1)
+
+	for idx := 0; idx < len(args); idx++ {
+		arg := args[idx]
+
+		switch {
+		case arg == "--":
+			for rest := idx + 1; rest < len(args); rest++ {
+				positionals = append(positionals, rest)
+			}
+
+			idx = len(args)
+		case arg == StdinScript || !strings.HasPrefix(arg, "-"):
+			positionals = append(positionals, idx)
+		case strings.HasPrefix(arg, "--"):
+			next, err := parsed.parseLong(args, idx)
+			if err != nil {
+				return nil, err
+			}
+
+			idx = next
+		default:
+			next, err := parsed.parseShort(args, idx)
+			if err != nil {
+				return nil, err
+			}
+
+			idx = next
+		}
+	}
+
+	parsed.setPositionals(args, positionals)
+
+	return parsed, nil
+}
+
+func (a *Args) setPositionals(args []string, positionals []int) {
+	if len(positionals) == 0 {
+		return
+	}
+
+	a.Command = append(a.Command, args[positionals[0]])
+	positionals = positionals[1:]
+
+	if a.Command[0] == "cloud" && len(positionals) > 0 && slices.Contains(cloudSubcommands, args[positionals[0]]) {
+		a.Command = append(a.Command, args[positionals[0]])
+		positionals = positionals[1:]
+	}
+
+	if len(positionals) == 0 || !slices.Contains(scriptCommands, strings.Join(a.Command, " ")) {
+		return
+	}
+
+	a.ScriptIndex = positionals[len(positionals)-1]
+	a.Script = args[a.ScriptIndex]
+}
+
+// parseLong parses the long flag at idx and returns the index of the last argument consumed.
+func (a *Args) parseLong(args []string, idx int) (int, error) {
+	name, value, hasValue := strings.Cut(strings.TrimPrefix(args[idx], "--"), "=")
+
+	if hasValue || !takesValue(name) {
+		a.Flags[name] = append(a.Flags[name], value)
+
+		return idx, nil
+	}
+
+	if idx+1 == len(args) {
+		return idx, fmt.Errorf("%w: flag needs an argument: --%s", ErrInvalidArgs, name)
+	}
+
+	a.Flags[name] = append(a.Flags[name], args[idx+1])
+
+	return idx + 1, nil
+}
+
+// parseShort parses the (possibly combined) shorthand flags at idx
+// and returns the index of the last argument consumed.
+func (a *Args) parseShort(args []string, idx int) (int, error) {
+	shorthands := strings.TrimPrefix(args[idx], "-")
+
+	for pos := 0; pos < len(shorthands); pos++ {
+		short := shorthands[pos : pos+1]
+
+		name, known := shortFlags[short]
+		if !known {
+			name = short
+		}
+
+		rest := shorthands[pos+1:]
+
+		switch {
+		case strings.HasPrefix(rest, "="):
+			a.Flags[name] = append(a.Flags[name], rest[1:])
+
+			return idx, nil
+		case !takesValue(name):
+			a.Flags[name] = append(a.Flags[name], "")
+
+			continue
+		case len(rest) > 0:
+			a.Flags[name] = append(a.Flags[name], rest)
+
+			return idx, nil
+		case idx+1 == len(args):
+			return idx, fmt.Errorf("%w: flag needs an argument: -%s", ErrInvalidArgs, short)
+		default:
+			a.Flags[name] = append(a.Flags[name], args[idx+1])
+
+			return idx + 1, nil
+		}
+	}
+
+	return idx, nil
+}
+
+func takesValue(name string) bool {
+	_, found := valueFlags[name]
+
+	return found
+}
+
+//nolint:gochecknoglobals
+var (
+	// scriptCommands contains the k6 commands with a script (or archive) argument.
+	scriptCommands = []string{"run", "archive", "inspect", "cloud", "cloud run", "cloud upload"}
+
+	// cloudSubcommands contains the nested subcommands of the k6 cloud command.
+	cloudSubcommands = []string{"run", "upload", "login"}
+
+	// valueFlags contains the k6 flags that take a value, with their shorthand (if any).
+	// Flags with an optional value (e.g. --http-debug) are not included,
+	// as their value can only be given in the --flag=value form.
+	valueFlags = map[string]string{
+		"address":                    "a",
+		"archive-out":                "O",
+		"batch":                      "",
+		"batch-per-host":             "",
+		"blacklist-ip":               "",
+		"block-hostnames":            "",
+		"compatibility-mode":         "",
+		"config":                     "c",
+		"console-output":             "",
+		"dns":                        "",
+		"duration":                   "d",
+		"env":                        "e",
+		"execution-segment":          "",
+		"execution-segment-sequence": "",
+		"iterations":                 "i",
+		"local-ips":                  "",
+		"log-format":                 "",
+		"log-output":                 "",
+		"max-redirects":              "",
+		"min-iteration-duration":     "",
+		"out":                        "o",
+		"project-id":                 "",
+		"rps":                        "",
+		"secret-source":              "",
+		"setup-timeout":              "",
+		"stage":                      "s",
+		"summary-export":             "",
+		"summary-mode":               "",
+		"summary-time-unit":          "",
+		"summary-trend-stats":        "",
+		"system-tags":                "",
+		"tag":                        "",
+		"teardown-timeout":           "",
+		"token":                      "",
+		"traces-output":              "",
+		"type":                       "t",
+		"user-agent":                 "",
+		"vus":                        "u",
+	}
+
+	// shortFlags contains the long names of the k6 shorthand flags.
+	shortFlags = withValueShorthands(map[string]string{
+		"l": "linger",
+		"p": "paused",
+		"q": "quiet",
+		"v": "verbose",
+		"w": "throw",
+	})
+)
+
+func withValueShorthands(flags map[string]string) map[string]string {
+	for name, short := range valueFlags {
+		if len(short) > 0 {
+			flags[short] = name
+		}
+	}
+
+	return flags
+}
@@ -0,0 +1,188 @@
+package k6exec_test
+
+import (
+	"testing"
+
+	"github.com/grafana/k6exec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		args    []string
+		command []string
+		script  string
+		index   int
+		flags   map[string][]string
+	}{
+		{
+			name:  "empty",
+			args:  nil,
+			index: -1,
+		},
+		{
+			name:    "no script command",
+			args:    []string{"version"},
+			command: []string{"version"},
+			index:   -1,
+		},
+		{
+			name:    "run",
+			args:    []string{"run", "script.js"},
+			command: []string{"run"},
+			script:  "script.js",
+			index:   1,
+		},
+		{
+			name:    "run without script",
+			args:    []string{"run", "--vus", "10"},
+			command: []string{"run"},
+			index:   -1,
+			flags:   map[string][]string{"vus": {"10"}},
+		},
+		{
+			name:    "flags after script",
+			args:    []string{"run", "script.js", "--out", "json=x.json"},
+			command: []string{"run"},
+			script:  "script.js",
+			index:   1,
+			flags:   map[string][]string{"out": {"json=x.json"}},
+		},
+		{
+			name:    "flags before command",
+			args:    []string{"-v", "--config", "config.json", "run", "script.js"},
+			command: []string{"run"},
+			script:  "script.js",
+			index:   4,
+			flags:   map[string][]string{"verbose": {""}, "config": {"config.json"}},
+		},
+		{
+			name:    "repeated flags",
+			args:    []string{"run", "-o", "json=x.json", "--out=csv=x.csv", "-e", "A=1", "script.js"},
+			command: []string{"run"},
+			script:  "script.js",
+			index:   6,
+			flags:   map[string][]string{"out": {"json=x.json", "csv=x.csv"}, "env": {"A=1"}},
+		},
+		{
+			name:    "combined shorthands",
+			args:    []string{"run", "-qvu10", "-d=1m", "script.js"},
+			command: []string{"run"},
+			script:  "script.js",
+			index:   3,
+			flags:   map[string][]string{"quiet": {""}, "verbose": {""}, "vus": {"10"}, "duration": {"1m"}},
+		},
+		{
+			name:    "unknown flags",
+			args:    []string{"run", "--no-such-flag", "script.js", "--other=value"},
+			command: []string{"run"},
+			script:  "script.js",
+			index:   2,
+			flags:   map[string][]string{"no-such-flag": {""}, "other": {"value"}},
+		},
+		{
+			name:    "stdin",
+			args:    []string{"run", "--vus", "2", "-"},
+			command: []string{"run"},
+			script:  "-",
+			index:   3,
+			flags:   map[string][]string{"vus": {"2"}},
+		},
+		{
+			name:    "double dash",
+			args:    []string{"run", "--vus", "2", "--", "-script.js"},
+			command: []string{"run"},
+			script:  "-script.js",
+			index:   4,
+			flags:   map[string][]string{"vus": {"2"}},
+		},
+		{
+			name:    "archive",
+			args:    []string{"archive", "-O", "archive.tar", "script.js"},
+			command: []string{"archive"},
+			script:  "script.js",
+			index:   3,
+			flags:   map[string][]string{"archive-out": {"archive.tar"}},
+		},
+		{
+			name:    "legacy cloud",
+			args:    []string{"cloud", "--exit-on-running", "script.js"},
+			command: []string{"cloud"},
+			script:  "script.js",
+			index:   2,
+			flags:   map[string][]string{"exit-on-running": {""}},
+		},
+		{
+			name:    "cloud run",
+			args:    []string{"cloud", "run", "--local-execution", "script.js", "-o", "json"},
+			command: []string{"cloud", "run"},
+			script:  "script.js",
+			index:   3,
+			flags:   map[string][]string{"local-execution": {""}, "out": {"json"}},
+		},
+		{
+			name:    "cloud upload",
+			args:    []string{"cloud", "upload", "archive.tar"},
+			command: []string{"cloud", "upload"},
+			script:  "archive.tar",
+			index:   2,
+		},
+		{
+			name:    "cloud login",
+			args:    []string{"cloud", "login", "--token", "secret"},
+			command: []string{"cloud", "login"},
+			index:   -1,
+			flags:   map[string][]string{"token": {"secret"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			args, err := k6exec.ParseArgs(tt.args)
+			require.NoError(t, err)
+
+			require.Equal(t, tt.command, args.Command)
+			require.Equal(t, tt.script, args.Script)
+			require.Equal(t, tt.index, args.ScriptIndex)
+			require.Equal(t, tt.index >= 0, args.HasScript())
+
+			if tt.flags == nil {
+				tt.flags = map[string][]string{}
+			}
+
+			require.Equal(t, tt.flags, args.Flags)
+		})
+	}
+}
+
+func TestParseArgs_errors(t *testing.T) {
+	t.Parallel()
+
+	for _, args := range [][]string{
+		{"run", "script.js", "--out"},
+		{"run", "script.js", "-o"},
+		{"run", "script.js", "-qo"},
+	} {
+		_, err := k6exec.ParseArgs(args)
+		require.ErrorIs(t, err, k6exec.ErrInvalidArgs)
+	}
+}
+
+func TestArgs_Flag(t *testing.T) {
+	t.Parallel()
+
+	args, err := k6exec.ParseArgs([]string{"run", "-c", "first.json", "--config", "last.json", "script.js"})
+	require.NoError(t, err)
+
+	value, found := args.Flag("config")
+	require.True(t, found)
+	require.Equal(t, "last.json", value)
+
+	_, found = args.Flag("out")
+	require.False(t, found)
+}
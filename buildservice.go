@@ -0,0 +1,306 @@
+package k6exec
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/k6deps"
+)
+
+var (
+	// ErrBuildService is returned when the build service cannot provide the k6 executable,
+	// or the k6 executable cannot be downloaded.
+	ErrBuildService = errors.New("build service error")
+	// ErrInvalidDependencies is returned when the build service cannot satisfy the dependencies
+	// (e.g. an unknown extension or a version constraint no version satisfies).
+	ErrInvalidDependencies = errors.New("invalid dependencies")
+)
+
+const (
+	buildPath = "build"
+	// invalidParameters identifies the errors of the build service caused by the requested dependencies.
+	invalidParameters = "invalid build parameters"
+	// encodedChecksumSize is the maximum size of a checksum encoded in base64 instead of hex by the build service.
+	encodedChecksumSize = 64
+)
+
+// artifact is the k6 executable satisfying the dependencies, provided by the build service.
+type artifact struct {
+	// ID identifies the k6 executable: the same ID is returned for the dependencies it satisfies.
+	ID string `json:"id,omitempty"`
+	// URL is the download URL of the k6 executable.
+	URL          string            `json:"url,omitempty"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	Platform     string            `json:"platform,omitempty"`
+	Checksum     string            `json:"checksum,omitempty"`
+}
+
+type buildDependency struct {
+	Name        string `json:"name,omitempty"`
+	Constraints string `json:"constraints,omitempty"`
+}
+
+type buildRequest struct {
+	K6Constraints string            `json:"k6,omitempty"`
+	Dependencies  []buildDependency `json:"dependencies,omitempty"`
+	Platform      string            `json:"platform,omitempty"`
+}
+
+type buildResponse struct {
+	Error    *buildError `json:"error,omitempty"`
+	Artifact artifact    `json:"artifact"`
+}
+
+// buildError is the error reported by the build service, with its chain of reasons.
+type buildError struct {
+	Err    string      `json:"error,omitempty"`
+	Reason *buildError `json:"reason,omitempty"`
+}
+
+func (e *buildError) Error() string {
+	if e.Reason == nil {
+		return e.Err
+	}
+
+	return e.Err + ": " + e.Reason.Error()
+}
+
+// has returns whether the error or one of its reasons is the given error of the build service.
+func (e *buildError) has(err string) bool {
+	for ; e != nil; e = e.Reason {
+		if e.Err == err {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requestArtifact requests the k6 executable satisfying the dependencies for the platform from the build service.
+// Like k6provider, the URL and the token of the build service default to the K6_BUILD_SERVICE_URL
+// and the K6_BUILD_SERVICE_AUTH environment variables.
+func requestArtifact(
+	ctx context.Context,
+	serviceURL string,
+	token string,
+	platform string,
+	deps k6deps.Dependencies,
+) (*artifact, error) {
+	if len(serviceURL) == 0 {
+		serviceURL = os.Getenv("K6_BUILD_SERVICE_URL") //nolint:forbidigo
+	}
+
+	if len(token) == 0 {
+		token = os.Getenv("K6_BUILD_SERVICE_AUTH") //nolint:forbidigo
+	}
+
+	base, err := url.Parse(serviceURL)
+	if err != nil || len(base.Host) == 0 {
+		return nil, fmt.Errorf("%w: invalid build service URL %q", ErrBuildService, serviceURL)
+	}
+
+	body, err := json.Marshal(newBuildRequest(platform, deps))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base.JoinPath(buildPath).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBuildService, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := httpClient(ctx).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBuildService, err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	var result buildResponse
+
+	// the error of the build service is reported in the body, which may be missing for an unsuccessful status
+	derr := json.NewDecoder(resp.Body).Decode(&result)
+
+	switch {
+	case result.Error != nil && result.Error.has(invalidParameters):
+		return nil, fmt.Errorf("%w: %w: %s", ErrBuildService, ErrInvalidDependencies, result.Error.Error())
+	case result.Error != nil && resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%w: %w: %s", ErrBuildService, newStatusError(resp), result.Error.Error())
+	case result.Error != nil:
+		return nil, fmt.Errorf("%w: %s", ErrBuildService, result.Error.Error())
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%w: %w", ErrBuildService, newStatusError(resp))
+	case derr != nil:
+		return nil, fmt.Errorf("%w: invalid response: %w", ErrBuildService, derr)
+	}
+
+	art := &result.Artifact
+
+	// the ID is used as a directory name in the binary cache directory
+	if len(art.ID) == 0 || !filepath.IsLocal(art.ID) || strings.ContainsAny(art.ID, `/\`) {
+		return nil, fmt.Errorf("%w: invalid artifact ID %q", ErrBuildService, art.ID)
+	}
+
+	// depending on the artifact store, the checksum may be encoded in base64
+	if len(art.Checksum) < encodedChecksumSize {
+		decoded, err := base64.StdEncoding.DecodeString(art.Checksum)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid checksum %q", ErrBuildService, art.Checksum)
+		}
+
+		art.Checksum = hex.EncodeToString(decoded)
+	}
+
+	return art, nil
+}
+
+func newBuildRequest(platform string, deps k6deps.Dependencies) *buildRequest {
+	req := &buildRequest{K6Constraints: "*", Platform: platform}
+
+	for _, name := range slices.Sorted(maps.Keys(deps)) {
+		constraints := deps[name].GetConstraints().String()
+
+		if name == k6deps.NameK6 {
+			req.K6Constraints = constraints
+
+			continue
+		}
+
+		req.Dependencies = append(req.Dependencies, buildDependency{Name: name, Constraints: constraints})
+	}
+
+	return req
+}
+
+// downloadArtifact downloads the k6 executable to exe, checking its checksum.
+// The k6 executable is written to a temporary file first, so it is never found partially written.
+func downloadArtifact(ctx context.Context, art *artifact, exe string, opts *Options) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, art.URL, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBuildService, err)
+	}
+
+	for name, values := range downloadHeader(opts) {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	resp, err := httpClient(ctx).Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: downloading k6 binary: %w", ErrBuildService, err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: downloading k6 binary: %w", ErrBuildService, newStatusError(resp))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(exe), 0o700); err != nil { //nolint:forbidigo,mnd
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "k6-*.download") //nolint:forbidigo
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) //nolint:errcheck,forbidigo
+
+	body := progressFromContext(ctx).track("downloading k6 binary", resp.Body, resp.ContentLength)
+	defer body.Close() //nolint:errcheck
+
+	hash := sha256.New()
+
+	_, err = io.Copy(io.MultiWriter(tmp, hash), body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: downloading k6 binary: %w", ErrBuildService, err)
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != art.Checksum {
+		return fmt.Errorf("%w: downloading k6 binary: checksum mismatch: expected %s, got %s",
+			ErrBuildService, art.Checksum, sum)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o700); err != nil { //nolint:forbidigo,mnd
+		return err
+	}
+
+	return os.Rename(tmp.Name(), exe) //nolint:forbidigo
+}
+
+// statusError is returned when the build service (or the download server) responds with an unsuccessful status.
+type statusError struct {
+	status string
+	code   int
+	// retryAfter is the wait requested by the Retry-After header, if any.
+	retryAfter time.Duration
+}
+
+func newStatusError(resp *http.Response) *statusError {
+	return &statusError{
+		status:     resp.Status,
+		code:       resp.StatusCode,
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+func (e *statusError) Error() string {
+	return "unexpected status " + e.status
+}
+
+// parseRetryAfter returns the wait requested by the value of the Retry-After header, given either
+// in seconds or as an HTTP date. It returns 0 if the value is missing or invalid, or the date is past.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0
+	}
+
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0
+	}
+
+	return max(date.Sub(now), 0)
+}
+
+// executableName returns the name of the k6 executable for the platform.
+func executableName(platform string) string {
+	if strings.HasPrefix(platform, "windows/") {
+		return "k6.exe"
+	}
+
+	return "k6"
+}
@@ -0,0 +1,168 @@
+package k6exec
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/grafana/k6exec/internal/k6exectest"
+	"github.com/stretchr/testify/require"
+)
+
+// respond returns a server responding to all requests with the status and the body.
+func respond(t *testing.T, status int, body string) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv.URL
+}
+
+func Test_requestArtifact(t *testing.T) {
+	t.Parallel()
+
+	svc := newBuildService(t, nil)
+
+	var deps k6deps.Dependencies
+
+	require.NoError(t, deps.UnmarshalText([]byte("k6>0.54;k6/x/faker>0.3")))
+
+	art, err := requestArtifact(context.Background(), svc.URL, "", "linux/amd64", deps)
+	require.NoError(t, err)
+	require.Equal(t, buildID("linux/amd64", art.Dependencies), art.ID)
+	require.Equal(t, map[string]string{"k6": "v0.55.0", "k6/x/faker": "v0.4.0"}, art.Dependencies)
+	require.Equal(t, k6exectest.K6Checksum, art.Checksum)
+
+	require.NoError(t, deps.UnmarshalText([]byte("k6/x/unknown*")))
+
+	_, err = requestArtifact(context.Background(), svc.URL, "", "linux/amd64", deps)
+	require.ErrorIs(t, err, ErrBuildService)
+	require.ErrorIs(t, err, ErrInvalidDependencies)
+	require.ErrorContains(t, err, "unsupported extension k6/x/unknown")
+}
+
+func Test_requestArtifact_response(t *testing.T) {
+	t.Parallel()
+
+	sum, err := hex.DecodeString(k6exectest.K6Checksum)
+	require.NoError(t, err)
+
+	encoded := base64.StdEncoding.EncodeToString(sum)
+
+	art, err := requestArtifact(context.Background(),
+		respond(t, http.StatusOK, `{"artifact":{"id":"abc","checksum":"`+encoded+`"}}`), "", "linux/amd64", nil)
+	require.NoError(t, err)
+	require.Equal(t, k6exectest.K6Checksum, art.Checksum, "base64 checksum")
+
+	for name, tt := range map[string]struct {
+		status int
+		body   string
+		msg    string
+	}{
+		"build error":    {http.StatusOK, `{"error":{"error":"building artifact","reason":{"error":"timeout"}}}`, "building artifact: timeout"},
+		"status":         {http.StatusServiceUnavailable, "unavailable", "unexpected status 503 Service Unavailable"},
+		"invalid body":   {http.StatusOK, "<html>", "invalid response"},
+		"missing ID":     {http.StatusOK, `{"artifact":{"checksum":"` + k6exectest.K6Checksum + `"}}`, "invalid artifact ID"},
+		"nonlocal ID":    {http.StatusOK, `{"artifact":{"id":"../abc","checksum":"` + k6exectest.K6Checksum + `"}}`, "invalid artifact ID"},
+		"invalid digest": {http.StatusOK, `{"artifact":{"id":"abc","checksum":"!"}}`, "invalid checksum"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := requestArtifact(context.Background(), respond(t, tt.status, tt.body), "", "linux/amd64", nil)
+			require.ErrorIs(t, err, ErrBuildService)
+			require.NotErrorIs(t, err, ErrInvalidDependencies)
+			require.ErrorContains(t, err, tt.msg)
+		})
+	}
+}
+
+func Test_requestArtifact_token(t *testing.T) {
+	t.Parallel()
+
+	var auth string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_, _ = io.WriteString(w, `{"artifact":{"id":"abc","checksum":"`+k6exectest.K6Checksum+`"}}`)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	_, err := requestArtifact(context.Background(), srv.URL, "secret", "linux/amd64", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Bearer secret", auth)
+}
+
+func Test_newBuildRequest(t *testing.T) {
+	t.Parallel()
+
+	var deps k6deps.Dependencies
+
+	require.NoError(t, deps.UnmarshalText([]byte("k6/x/sql>=1.0.1;k6>0.54;k6/x/faker*")))
+
+	require.Equal(t, &buildRequest{
+		K6Constraints: ">0.54",
+		Dependencies: []buildDependency{
+			{Name: "k6/x/faker", Constraints: "*"},
+			{Name: "k6/x/sql", Constraints: ">=1.0.1"},
+		},
+		Platform: "linux/amd64",
+	}, newBuildRequest("linux/amd64", deps))
+
+	require.Equal(t, &buildRequest{K6Constraints: "*", Platform: "windows/amd64"}, newBuildRequest("windows/amd64", nil))
+}
+
+func Test_downloadArtifact(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "abc", "k6")
+
+	art := &artifact{ID: "abc", URL: respond(t, http.StatusOK, "k6"), Checksum: k6exectest.K6Checksum}
+
+	require.NoError(t, downloadArtifact(context.Background(), art, exe, &Options{}))
+
+	data, err := os.ReadFile(exe) //nolint:forbidigo
+	require.NoError(t, err)
+	require.Equal(t, "k6", string(data))
+
+	// neither a corrupted nor a missing k6 executable is left in the cache
+	other := filepath.Join(dir, "def", "k6")
+
+	art = &artifact{ID: "def", URL: respond(t, http.StatusOK, "corrupted"), Checksum: k6exectest.K6Checksum}
+
+	err = downloadArtifact(context.Background(), art, other, &Options{})
+	require.ErrorIs(t, err, ErrBuildService)
+	require.ErrorContains(t, err, "checksum mismatch")
+	require.NoFileExists(t, other)
+
+	art = &artifact{ID: "def", URL: respond(t, http.StatusNotFound, ""), Checksum: k6exectest.K6Checksum}
+
+	err = downloadArtifact(context.Background(), art, other, &Options{})
+	require.ErrorIs(t, err, ErrBuildService)
+	require.NoFileExists(t, other)
+
+	entries, err := os.ReadDir(filepath.Dir(other)) //nolint:forbidigo
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func Test_executableName(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "k6", executableName("linux/amd64"))
+	require.Equal(t, "k6.exe", executableName("windows/amd64"))
+}
@@ -0,0 +1,627 @@
+package k6exec
+
+import (
+	"context"
+	"debug/buildinfo"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/grafana/k6deps"
+)
+
+const (
+	// binaryIndexName is the name of the file in the cache directory
+	// that records the provisioned k6 executables and their dependencies.
+	binaryIndexName = "binaries.json"
+	// providerCacheDir is the directory in the user cache directory used by k6provider by default.
+	providerCacheDir = "k6provider"
+	// k6Module is the Go module of k6.
+	k6Module = "go.k6.io/k6"
+)
+
+// ErrOffline is returned in offline mode if no cached k6 executable satisfies the dependencies.
+var ErrOffline = errors.New("offline mode")
+
+// CachedBinary contains the properties of a cached k6 executable.
+type CachedBinary struct {
+	// Path contains the path of the k6 executable.
+	Path string
+	// Dependencies contains the resolved version of k6 and the extensions, indexed by name.
+	Dependencies map[string]string
+	// Platform contains the platform of the k6 executable (os/arch).
+	Platform string
+	// Size contains the size of the k6 executable in bytes.
+	Size int64
+	// LastUsed contains the time the k6 executable was last provisioned.
+	LastUsed time.Time
+}
+
+// cachedBinary contains the properties of a provisioned k6 executable.
+type cachedBinary struct {
+	Path         string            `json:"path"`
+	Checksum     string            `json:"checksum"`
+	Dependencies map[string]string `json:"dependencies"`
+	Platform     string            `json:"platform"`
+	LastUsed     time.Time         `json:"last_used"`
+}
+
+// binaryIndex records the metadata (dependencies, platform, last use) of the k6 executables
+// found in the cache directories, which cannot be obtained from k6provider without the build service.
+type binaryIndex struct {
+	Binaries []*cachedBinary `json:"binaries"`
+
+	path string
+}
+
+// cacheDir returns the cache directory: Options.CacheDir, or the AppName directory in the user cache directory.
+func cacheDir(opts *Options) (string, error) {
+	if len(opts.CacheDir) > 0 {
+		return opts.CacheDir, nil
+	}
+
+	base, err := os.UserCacheDir() //nolint:forbidigo
+	if err != nil {
+		return "", err
+	}
+
+	appname := opts.AppName
+	if len(appname) == 0 {
+		appname = filepath.Base(os.Args[0]) //nolint:forbidigo
+	}
+
+	return filepath.Join(base, appname), nil
+}
+
+// binaryCacheDir returns the directory of the k6 executables provided by the build service:
+// Options.BinaryCacheDir, or the k6provider directory in the user cache directory.
+func binaryCacheDir(opts *Options) (string, error) {
+	if len(opts.BinaryCacheDir) > 0 {
+		return opts.BinaryCacheDir, nil
+	}
+
+	base, err := os.UserCacheDir() //nolint:forbidigo
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(base, providerCacheDir), nil
+}
+
+// scanCache returns the k6 executables found in the cache directories: the one of k6provider
+// and the local builds. Both of them store each k6 executable in its own subdirectory.
+func scanCache(opts *Options) ([]string, error) {
+	bindir, err := binaryCacheDir(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := cacheDir(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+
+	for _, dir := range []string{bindir, filepath.Join(dir, localBuildsDir)} {
+		entries, err := os.ReadDir(dir) //nolint:forbidigo
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+
+			for _, name := range []string{"k6", "k6.exe"} {
+				path := filepath.Join(dir, entry.Name(), name)
+
+				if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() { //nolint:forbidigo
+					paths = append(paths, path)
+				}
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+// loadBinaryIndex loads the index of the cached k6 executables. A missing index is empty.
+func loadBinaryIndex(opts *Options) (*binaryIndex, error) {
+	dir, err := cacheDir(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &binaryIndex{path: filepath.Join(dir, binaryIndexName)}
+
+	data, err := os.ReadFile(index.path) //nolint:forbidigo,gosec
+	if errors.Is(err, os.ErrNotExist) {  //nolint:forbidigo
+		return index, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("%s: %w", index.path, err)
+	}
+
+	return index, nil
+}
+
+// lockBinaryIndex acquires the lock of the index (shared by the processes using the same cache directory)
+// and loads the index. The returned function releases the lock.
+func lockBinaryIndex(opts *Options) (*binaryIndex, func(), error) {
+	dir, err := cacheDir(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	release, err := acquireLock(context.Background(), filepath.Join(dir, binaryIndexName+".lock"), opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	index, err := loadBinaryIndex(opts)
+	if err != nil {
+		release()
+
+		return nil, nil, err
+	}
+
+	return index, release, nil
+}
+
+// syncBinaryIndex acquires the lock of the index and loads it like lockBinaryIndex,
+// then adds the k6 executables found in the cache directories missing from the index.
+func syncBinaryIndex(opts *Options) (*binaryIndex, func(), error) {
+	index, release, err := lockBinaryIndex(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := index.sync(opts); err != nil {
+		release()
+
+		return nil, nil, err
+	}
+
+	return index, release, nil
+}
+
+// sync adds the k6 executables of the cache directories missing from the index (e.g. provisioned
+// by another k6provider client). Their metadata is read from the build information of the executable.
+func (index *binaryIndex) sync(opts *Options) error {
+	paths, err := scanCache(opts)
+	if err != nil {
+		return err
+	}
+
+	var modules map[string][]string
+
+	for _, path := range paths {
+		if index.lookup(path) != nil {
+			continue
+		}
+
+		if modules == nil {
+			modules = catalogModules(opts)
+		}
+
+		index.Binaries = append(index.Binaries, inspectBinary(path, modules))
+	}
+
+	if modules == nil {
+		return nil
+	}
+
+	return index.save()
+}
+
+// lookup returns the record of the k6 executable, or nil if it is not recorded.
+func (index *binaryIndex) lookup(path string) *cachedBinary {
+	idx := slices.IndexFunc(index.Binaries, func(cached *cachedBinary) bool { return cached.Path == path })
+	if idx < 0 {
+		return nil
+	}
+
+	return index.Binaries[idx]
+}
+
+// catalogModules returns the dependency names of the Go modules, using the extension catalog
+// available without network access (a catalog file or the cached catalog).
+func catalogModules(opts *Options) map[string][]string {
+	offline := *opts
+	offline.Offline = true
+
+	catalog, err := loadCatalog(context.Background(), &offline)
+	if err != nil {
+		slog.Debug("extension catalog not available, only k6 is identified in cached binaries", "error", err)
+	}
+
+	modules := make(map[string][]string, len(catalog)+1)
+
+	for name, entry := range catalog {
+		modules[entry.Module] = append(modules[entry.Module], name)
+	}
+
+	if _, found := modules[k6Module]; !found {
+		modules[k6Module] = []string{k6deps.NameK6}
+	}
+
+	return modules
+}
+
+// inspectBinary returns the metadata of the k6 executable read from its build information.
+// The dependencies are the Go modules of the executable known by the modules map.
+// If the build information cannot be read, the executable has no platform and dependencies,
+// so it is only used for cache management.
+func inspectBinary(path string, modules map[string][]string) *cachedBinary {
+	cached := &cachedBinary{Path: path, Dependencies: make(map[string]string)}
+
+	if info, err := os.Stat(path); err == nil { //nolint:forbidigo
+		cached.LastUsed = info.ModTime()
+	}
+
+	build, err := buildinfo.ReadFile(path)
+	if err != nil {
+		slog.Debug("cached binary not identified", "path", path, "error", err)
+
+		return cached
+	}
+
+	var goos, goarch string
+
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "GOOS":
+			goos = setting.Value
+		case "GOARCH":
+			goarch = setting.Value
+		}
+	}
+
+	if len(goos) > 0 && len(goarch) > 0 {
+		cached.Platform = goos + "/" + goarch
+	}
+
+	for _, mod := range append([]*debug.Module{&build.Main}, build.Deps...) {
+		version := mod.Version
+		if mod.Replace != nil && len(mod.Replace.Version) > 0 {
+			version = mod.Replace.Version
+		}
+
+		for _, name := range modules[mod.Path] {
+			cached.Dependencies[name] = version
+		}
+	}
+
+	return cached
+}
+
+// save writes the index, replacing the previous one atomically.
+func (index *binaryIndex) save() error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(index.path, data)
+}
+
+// writeFileAtomic writes the file, replacing the previous one atomically: readers get either the previous
+// or the new content. Concurrent writers use distinct temporary files, so the content is never mixed.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil { //nolint:forbidigo,mnd
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp") //nolint:forbidigo
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), path) //nolint:forbidigo
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name()) //nolint:forbidigo
+	}
+
+	return err
+}
+
+// add records the provisioned binary, replacing the previous record with the same path.
+func (index *binaryIndex) add(binary *Binary, platform string) {
+	index.Binaries = slices.DeleteFunc(index.Binaries, func(cached *cachedBinary) bool {
+		return cached.Path == binary.Path
+	})
+
+	index.Binaries = append(index.Binaries, &cachedBinary{
+		Path:         binary.Path,
+		Checksum:     binary.Checksum,
+		Dependencies: binary.Dependencies,
+		Platform:     platform,
+		LastUsed:     time.Now(),
+	})
+}
+
+// find returns the cached binary satisfying the dependencies.
+// Binaries with the fewest extra dependencies are preferred, then the most recently used ones.
+// If none of them satisfies the dependencies, the error lists the dependencies not satisfied by any binary.
+func (index *binaryIndex) find(deps k6deps.Dependencies, platform string) (*cachedBinary, error) {
+	var found *cachedBinary
+
+	satisfied := make(map[string]bool, len(deps))
+
+	for _, cached := range index.Binaries {
+		if cached.Platform != platform {
+			continue
+		}
+
+		if _, err := os.Stat(cached.Path); err != nil { //nolint:forbidigo
+			continue
+		}
+
+		all := true
+
+		for name, dep := range deps {
+			if cached.satisfies(dep) {
+				satisfied[name] = true
+			} else {
+				all = false
+			}
+		}
+
+		if all && (found == nil || cached.preferred(found)) {
+			found = cached
+		}
+	}
+
+	if found != nil {
+		return found, nil
+	}
+
+	missing := make([]string, 0, len(deps))
+
+	for _, dep := range deps.Sorted() {
+		if !satisfied[dep.Name] {
+			missing = append(missing, dep.String())
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil, fmt.Errorf("%w: no cached k6 binary for %s contains all of %s",
+			ErrOffline, platform, deps.String())
+	}
+
+	return nil, fmt.Errorf("%w: no cached k6 binary for %s satisfies %s",
+		ErrOffline, platform, strings.Join(missing, ", "))
+}
+
+func (cached *cachedBinary) satisfies(dep *k6deps.Dependency) bool {
+	version, found := cached.Dependencies[dep.Name]
+	if !found {
+		return false
+	}
+
+	semversion, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+
+	return dep.GetConstraints().Check(semversion)
+}
+
+func (cached *cachedBinary) preferred(other *cachedBinary) bool {
+	if len(cached.Dependencies) != len(other.Dependencies) {
+		return len(cached.Dependencies) < len(other.Dependencies)
+	}
+
+	return cached.LastUsed.After(other.LastUsed)
+}
+
+func (cached *cachedBinary) binary() *Binary {
+	return &Binary{
+		Path:         cached.Path,
+		Dependencies: cached.Dependencies,
+		Checksum:     cached.Checksum,
+		Cached:       true,
+	}
+}
+
+// recordBinary records the provisioned binary in the index, for offline use.
+// Failing to record it does not prevent using the binary.
+func recordBinary(binary *Binary, platform string, opts *Options) {
+	index, release, err := lockBinaryIndex(opts)
+	if err == nil {
+		defer release()
+
+		index.add(binary, platform)
+		err = index.save()
+	}
+
+	if err != nil {
+		slog.Debug("binary not recorded in the cache index", "error", err)
+	}
+}
+
+// ListCache returns the cached k6 executables, the least recently used first. They include the k6 executables
+// found in Options.BinaryCacheDir and in the local builds, even if they are not recorded in the cache index.
+// The k6 executables that no longer exist are removed from the cache index.
+func ListCache(opts *Options) ([]CachedBinary, error) {
+	index, release, err := syncBinaryIndex(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	binaries := index.list()
+
+	return binaries, index.save()
+}
+
+// PruneCache removes the least recently used k6 executables exceeding Options.CacheMaxAge or
+// Options.CacheMaxSize. It returns the removed k6 executables.
+func PruneCache(opts *Options) ([]CachedBinary, error) {
+	return pruneCache(opts, "")
+}
+
+// ClearCache removes all the cached k6 executables. It returns the removed k6 executables.
+func ClearCache(opts *Options) ([]CachedBinary, error) {
+	index, release, err := syncBinaryIndex(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	return index.evict(index.list(), func(CachedBinary) bool { return true })
+}
+
+// pruneCache removes the least recently used k6 executables exceeding the limits, except the kept one.
+func pruneCache(opts *Options, keep string) ([]CachedBinary, error) {
+	if opts.CacheMaxAge <= 0 && opts.CacheMaxSize <= 0 {
+		return nil, nil
+	}
+
+	index, release, err := syncBinaryIndex(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	binaries := index.list()
+
+	var size int64
+
+	for _, binary := range binaries {
+		size += binary.Size
+	}
+
+	return index.evict(binaries, func(binary CachedBinary) bool {
+		expired := opts.CacheMaxAge > 0 && time.Since(binary.LastUsed) > opts.CacheMaxAge
+		oversized := opts.CacheMaxSize > 0 && size > opts.CacheMaxSize
+
+		if binary.Path == keep || (!expired && !oversized) {
+			return false
+		}
+
+		size -= binary.Size
+
+		return true
+	})
+}
+
+// list returns the existing k6 executables of the index, the least recently used first.
+// The k6 executables that no longer exist are removed from the index.
+func (index *binaryIndex) list() []CachedBinary {
+	binaries := make([]CachedBinary, 0, len(index.Binaries))
+	existing := make([]*cachedBinary, 0, len(index.Binaries))
+
+	for _, cached := range index.Binaries {
+		info, err := os.Stat(cached.Path) //nolint:forbidigo
+		if err != nil {
+			continue
+		}
+
+		existing = append(existing, cached)
+		binaries = append(binaries, CachedBinary{
+			Path:         cached.Path,
+			Dependencies: cached.Dependencies,
+			Platform:     cached.Platform,
+			Size:         info.Size(),
+			LastUsed:     cached.LastUsed,
+		})
+	}
+
+	index.Binaries = existing
+
+	slices.SortStableFunc(binaries, func(a, b CachedBinary) int { return a.LastUsed.Compare(b.LastUsed) })
+
+	return binaries
+}
+
+// evict removes the k6 executables selected by the evict function, in the given order.
+func (index *binaryIndex) evict(binaries []CachedBinary, evict func(CachedBinary) bool) ([]CachedBinary, error) {
+	removed := make([]CachedBinary, 0, len(binaries))
+
+	var errs []error
+
+	for _, binary := range binaries {
+		if !evict(binary) {
+			continue
+		}
+
+		slog.Debug("removing cached binary", "path", binary.Path, "last used", binary.LastUsed)
+
+		if err := removeBinary(binary.Path); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		removed = append(removed, binary)
+		index.Binaries = slices.DeleteFunc(index.Binaries, func(cached *cachedBinary) bool {
+			return cached.Path == binary.Path
+		})
+	}
+
+	if err := index.save(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+// removeBinary removes the k6 executable, its signature and its directory if it becomes empty.
+func removeBinary(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) { //nolint:forbidigo
+		return err
+	}
+
+	_ = os.Remove(path + signatureSuffix) //nolint:forbidigo
+	_ = os.Remove(filepath.Dir(path))     //nolint:forbidigo
+
+	return nil
+}
+
+// FormatSize formats the size in bytes using binary units (e.g. 1.5 MiB).
+func FormatSize(size int64) string {
+	const unit = 1024
+
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
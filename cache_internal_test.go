@@ -0,0 +1,254 @@
+package k6exec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6deps"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_provision_offline(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+
+	seed := func(name string, deps map[string]string, platform string, lastUsed time.Time) string {
+		path := filepath.Join(dir, name, "k6")
+
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))  //nolint:forbidigo
+		require.NoError(t, os.WriteFile(path, []byte("k6"), 0o700)) //nolint:forbidigo
+
+		index, err := loadBinaryIndex(&Options{CacheDir: dir})
+		require.NoError(t, err)
+
+		index.add(&Binary{Path: path, Checksum: name, Dependencies: deps}, platform)
+		index.Binaries[len(index.Binaries)-1].LastUsed = lastUsed
+		require.NoError(t, index.save())
+
+		return path
+	}
+
+	now := time.Now()
+
+	plain := seed("plain", map[string]string{"k6": "v0.57.0"}, platform, now.Add(-time.Hour))
+	faker := seed("faker", map[string]string{"k6": "v0.57.0", "k6/x/faker": "v0.4.1"}, platform, now.Add(-time.Hour))
+	newer := seed("newer", map[string]string{"k6": "v0.58.0", "k6/x/faker": "v0.4.2"}, platform, now)
+	foreign := seed("foreign", map[string]string{"k6": "v0.57.0", "k6/x/sql": "v0.4.0"}, "foreign/arch", now)
+
+	opts := &Options{CacheDir: dir, BinaryCacheDir: t.TempDir(), Offline: true}
+
+	tests := []struct {
+		name     string
+		deps     string
+		platform string
+		want     string
+		wantErr  string
+	}{
+		{name: "fewest extra dependencies", deps: "k6>0.50.0", want: plain},
+		{name: "most recently used", deps: "k6/x/faker>0.4.0", want: newer},
+		{name: "constraints", deps: "k6<0.58.0;k6/x/faker>0.4.0", want: faker},
+		{name: "missing", deps: "k6>0.50.0;k6/x/faker>0.5.0;k6/x/sql*", wantErr: "k6/x/faker>0.5.0, k6/x/sql*"},
+		{name: "no single binary", deps: "k6<0.58.0;k6/x/faker>v0.4.1", wantErr: "contains all of"},
+		{name: "other platform", deps: "k6/x/sql*", platform: "foreign/arch", want: foreign},
+		{name: "missing platform", deps: "k6>0.50.0", platform: "other/arch", wantErr: "other/arch"},
+	}
+
+	// the subtests are not parallel, as provisioning updates the last used time in the index
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { //nolint:paralleltest
+			var deps k6deps.Dependencies
+
+			require.NoError(t, deps.UnmarshalText([]byte(tt.deps)))
+
+			opts := *opts
+			opts.Platform = tt.platform
+
+			binary, err := provision(context.Background(), deps, &opts)
+			if len(tt.wantErr) > 0 {
+				require.ErrorIs(t, err, ErrOffline)
+				require.Contains(t, err.Error(), tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, binary.Path)
+			require.True(t, binary.Cached)
+		})
+	}
+}
+
+func Test_cache_management(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	opts := &Options{CacheDir: dir, BinaryCacheDir: t.TempDir()}
+	now := time.Now()
+
+	seed := func(name string, size int, lastUsed time.Time) string {
+		path := filepath.Join(dir, name, "k6")
+
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))                   //nolint:forbidigo
+		require.NoError(t, os.WriteFile(path, make([]byte, size), 0o700))            //nolint:forbidigo
+		require.NoError(t, os.WriteFile(path+signatureSuffix, []byte("sig"), 0o600)) //nolint:forbidigo
+
+		index, err := loadBinaryIndex(opts)
+		require.NoError(t, err)
+
+		index.add(&Binary{Path: path, Dependencies: map[string]string{"k6": name}}, "linux/amd64")
+		index.Binaries[len(index.Binaries)-1].LastUsed = lastUsed
+		require.NoError(t, index.save())
+
+		return path
+	}
+
+	oldest := seed("oldest", 100, now.Add(-48*time.Hour))
+	older := seed("older", 100, now.Add(-2*time.Hour))
+	newer := seed("newer", 100, now.Add(-time.Hour))
+	current := seed("current", 100, now)
+	removed := seed("removed", 100, now)
+
+	require.NoError(t, os.Remove(removed)) //nolint:forbidigo
+
+	// a local build not recorded in the index, its last use is the modification time
+	unindexed := filepath.Join(dir, localBuildsDir, "unindexed", "k6")
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(unindexed), 0o700))                           //nolint:forbidigo
+	require.NoError(t, os.WriteFile(unindexed, make([]byte, 100), 0o700))                     //nolint:forbidigo
+	require.NoError(t, os.Chtimes(unindexed, now.Add(-72*time.Hour), now.Add(-72*time.Hour))) //nolint:forbidigo
+
+	binaries, err := ListCache(opts)
+	require.NoError(t, err)
+	require.Len(t, binaries, 5)
+	require.Equal(t, unindexed, binaries[0].Path)
+	require.Empty(t, binaries[0].Dependencies)
+	require.Equal(t, oldest, binaries[1].Path)
+	require.Equal(t, int64(100), binaries[1].Size)
+	require.Equal(t, map[string]string{"k6": "oldest"}, binaries[1].Dependencies)
+
+	// no limits
+	pruned, err := pruneCache(opts, current)
+	require.NoError(t, err)
+	require.Empty(t, pruned)
+
+	// max age
+	opts.CacheMaxAge = 24 * time.Hour
+
+	pruned, err = pruneCache(opts, current)
+	require.NoError(t, err)
+	require.Len(t, pruned, 2)
+	require.Equal(t, unindexed, pruned[0].Path)
+	require.Equal(t, oldest, pruned[1].Path)
+	require.NoFileExists(t, unindexed)
+	require.NoFileExists(t, oldest)
+	require.NoFileExists(t, oldest+signatureSuffix)
+	require.NoDirExists(t, filepath.Dir(oldest))
+
+	// max size, the kept binary is not removed
+	opts.CacheMaxSize = 150
+
+	pruned, err = pruneCache(opts, current)
+	require.NoError(t, err)
+	require.Len(t, pruned, 2)
+	require.Equal(t, older, pruned[0].Path)
+	require.Equal(t, newer, pruned[1].Path)
+	require.FileExists(t, current)
+
+	opts.CacheMaxSize = 50
+
+	pruned, err = pruneCache(opts, current)
+	require.NoError(t, err)
+	require.Empty(t, pruned)
+
+	// clear
+	cleared, err := ClearCache(opts)
+	require.NoError(t, err)
+	require.Len(t, cleared, 1)
+	require.NoFileExists(t, current)
+
+	binaries, err = ListCache(opts)
+	require.NoError(t, err)
+	require.Empty(t, binaries)
+}
+
+func Test_provision_offline_unindexed(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	// the test executable stands for a k6 executable cached by k6provider but not recorded in the index,
+	// the catalog maps two of its modules to dependency names
+	data, err := os.ReadFile(os.Args[0]) //nolint:forbidigo
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "k6provider", "artifact", "k6")
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700)) //nolint:forbidigo
+	require.NoError(t, os.WriteFile(path, data, 0o700))        //nolint:forbidigo
+
+	catalog := filepath.Join(dir, "catalog.json")
+
+	require.NoError(t, os.WriteFile(catalog, []byte(`{
+		"k6": {"module": "github.com/Masterminds/semver/v3"},
+		"k6/x/deps": {"module": "github.com/grafana/k6deps"}
+	}`), 0o600)) //nolint:forbidigo
+
+	build, ok := debug.ReadBuildInfo()
+	require.True(t, ok)
+
+	want := make(map[string]string)
+
+	for _, mod := range build.Deps {
+		switch mod.Path {
+		case "github.com/Masterminds/semver/v3":
+			want["k6"] = mod.Version
+		case "github.com/grafana/k6deps":
+			want["k6/x/deps"] = mod.Version
+		}
+	}
+
+	require.Len(t, want, 2)
+
+	opts := &Options{
+		CacheDir:       filepath.Join(dir, "cache"),
+		BinaryCacheDir: filepath.Join(dir, "k6provider"),
+		CatalogURL:     catalog,
+		Offline:        true,
+	}
+
+	var deps k6deps.Dependencies
+
+	require.NoError(t, deps.UnmarshalText([]byte("k6>=3.0.0;k6/x/deps*")))
+
+	binary, err := provision(context.Background(), deps, opts)
+	require.NoError(t, err)
+	require.Equal(t, path, binary.Path)
+	require.Equal(t, want, binary.Dependencies)
+
+	binaries, err := ListCache(opts)
+	require.NoError(t, err)
+	require.Len(t, binaries, 1)
+	require.Equal(t, runtime.GOOS+"/"+runtime.GOARCH, binaries[0].Platform)
+
+	cleared, err := ClearCache(opts)
+	require.NoError(t, err)
+	require.Len(t, cleared, 1)
+	require.NoFileExists(t, path)
+}
+
+func Test_FormatSize(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "0 B", FormatSize(0))
+	require.Equal(t, "1023 B", FormatSize(1023))
+	require.Equal(t, "1.5 KiB", FormatSize(1536))
+	require.Equal(t, "120.0 MiB", FormatSize(120<<20))
+	require.Equal(t, "2.0 GiB", FormatSize(2<<30))
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const buildHelp = `Build the k6 executable for a k6 command and write it to a file.
+
+The k6 executable is provisioned the same way as by the provision command, then it is copied
+(or hard linked using --link) out of the cache to the output file, with executable permissions.
+The k6 executable can then be used without the launcher, e.g. on another machine.
+
+A hard linked output file is the same file as the cached k6 executable, with the permissions of
+the cached one: modifying it (e.g. stripping it or changing its permissions) modifies the cached
+k6 executable too. Removing the cached k6 executable (e.g. cache prune) does not remove the output.
+
+If the first argument is not a k6 command, it is taken as the script of the run command.
+Using the --metadata flag, the dependencies and the checksum of the k6 executable are also written
+to a JSON file next to the output file (with the .json suffix).
+
+An existing output file is not overwritten, unless --force is used.
+
+The flags of this command must precede the k6 command line, flags following it are passed to k6.`
+
+const buildExample = `  k6exec build -o ./bin/k6 script.js
+  k6exec build -o ./bin/k6 --metadata run --out json=results.json script.js
+  k6exec build -o ./k6-arm64 --platform linux/arm64 --deps "k6>0.54;k6/x/faker*"`
+
+var errOutputExists = errors.New("output file already exists, use --force to overwrite it")
+
+func newBuildCommand(state *state) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "build [flags] [--] [k6 command | script]",
+		Short:         "Build the k6 executable for a k6 command and write it to a file",
+		Long:          buildHelp,
+		Example:       buildExample,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE:          state.buildRunE,
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringVarP(&state.output, "output", "o", "",
+		"output file of the k6 executable (default k6 in the current directory)")
+	flags.BoolVar(&state.force, "force", false, "overwrite the output file if it exists")
+	flags.BoolVar(&state.link, "link", false,
+		"hard link the k6 executable from the cache instead of copying it, if possible (shares the file with the cache)")
+	flags.BoolVar(&state.metadata, "metadata", false,
+		"write the dependencies and the checksum of the k6 executable to a JSON file")
+	flags.StringVar(&state.deps, "deps", "", "dependencies to be provisioned, e.g. \"k6>0.54;k6/x/faker*\"")
+	// the flags following the k6 command (or the script) belong to the k6 command line
+	flags.SetInterspersed(false)
+
+	return cmd
+}
+
+func (s *state) buildRunE(cmd *cobra.Command, args []string) error {
+	output := s.output
+	if len(output) == 0 {
+		output = "k6"
+		if strings.HasPrefix(s.Platform, "windows/") || (len(s.Platform) == 0 && runtime.GOOS == "windows") {
+			output += ".exe"
+		}
+	}
+
+	metadata := output + ".json"
+
+	outputs := []string{output}
+	if s.metadata {
+		outputs = append(outputs, metadata)
+	}
+
+	// fail early, before provisioning
+	for _, filename := range outputs {
+		if _, err := os.Lstat(filename); err == nil && !s.force { //nolint:forbidigo
+			return fmt.Errorf("%w: %s", errOutputExists, filename)
+		}
+	}
+
+	if len(args) > 0 && !slices.Contains(commands, args[0]) {
+		args = append([]string{"run"}, args...)
+	}
+
+	binary, err := s.provisionBinary(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	if err := exportBinary(binary.Path, output, s.force, s.link); err != nil {
+		return err
+	}
+
+	if s.metadata {
+		if err := writeMetadata(metadata, newBinaryJSON(binary, output, s.Platform)); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s  %s\n", binary.Checksum, output)
+
+	return err
+}
+
+// exportBinary copies (or hard links) the k6 executable to the output file.
+// A hard link shares the file (content and permissions) with the cache entry, so it is not changed.
+//
+//nolint:forbidigo
+func exportBinary(exe string, output string, force bool, link bool) error {
+	if err := os.MkdirAll(filepath.Dir(output), 0o750); err != nil { //nolint:mnd
+		return err
+	}
+
+	if force {
+		if err := os.Remove(output); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	if link {
+		err := os.Link(exe, output)
+		if err == nil || errors.Is(err, os.ErrExist) {
+			return outputError(output, err)
+		}
+
+		slog.Debug("hard link failed, copying", "error", err)
+	}
+
+	src, err := os.Open(exe) //nolint:gosec
+	if err != nil {
+		return err
+	}
+
+	defer src.Close() //nolint:errcheck
+
+	dst, err := os.OpenFile(output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o755) //nolint:gosec,mnd
+	if err != nil {
+		return outputError(output, err)
+	}
+
+	if _, err = io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(output)
+
+		return err
+	}
+
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	// the permissions given when creating the file are restricted by the umask
+	return os.Chmod(output, 0o755) //nolint:mnd,gosec
+}
+
+func outputError(output string, err error) error {
+	if errors.Is(err, os.ErrExist) { //nolint:forbidigo
+		return fmt.Errorf("%w: %s", errOutputExists, output)
+	}
+
+	return err
+}
+
+// writeMetadata writes the properties of the exported k6 executable to the sidecar JSON file.
+func writeMetadata(filename string, metadata binaryJSON) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, append(data, '\n'), 0o644) //nolint:forbidigo,mnd,gosec
+}
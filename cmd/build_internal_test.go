@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/grafana/k6exec"
+	"github.com/grafana/k6exec/internal/k6exectest"
+	"github.com/stretchr/testify/require"
+)
+
+//nolint:forbidigo
+func Test_buildRunE(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "cache", "k6")
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(exe), 0o700))
+	require.NoError(t, os.WriteFile(exe, []byte("k6"), 0o600))
+
+	provisioner := &k6exectest.Provisioner[*k6exec.Binary]{
+		Binary: &k6exec.Binary{Path: exe, Dependencies: map[string]string{"k6": "v0.55.0"}},
+	}
+
+	st := &state{
+		levelVar: new(slog.LevelVar),
+		Options: k6exec.Options{
+			Env:         k6deps.Source{Ignore: true},
+			Manifest:    k6deps.Source{Ignore: true},
+			Provisioner: provisioner,
+		},
+	}
+
+	cmd := newBuildCommand(st)
+
+	var out bytes.Buffer
+
+	cmd.SetOut(&out)
+
+	output := filepath.Join(dir, "bin", "k6")
+	st.output = output
+	st.metadata = true
+
+	require.NoError(t, st.buildRunE(cmd, []string{filepath.Join("testdata", "script.js")}))
+	require.Equal(t, k6exectest.K6Checksum+"  "+output+"\n", out.String())
+	require.Equal(t, "k6>=v0.52", provisioner.Deps().String())
+
+	data, err := os.ReadFile(output)
+	require.NoError(t, err)
+	require.Equal(t, "k6", string(data))
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(output)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+	}
+
+	data, err = os.ReadFile(output + ".json")
+	require.NoError(t, err)
+
+	var metadata binaryJSON
+
+	require.NoError(t, json.Unmarshal(data, &metadata))
+	require.Equal(t, output, metadata.Path)
+	require.Equal(t, k6exectest.K6Checksum, metadata.Checksum)
+	require.Equal(t, map[string]string{"k6": "v0.55.0"}, metadata.Dependencies)
+
+	// not overwritten
+	require.ErrorIs(t, st.buildRunE(cmd, []string{"run", filepath.Join("testdata", "script.js")}), errOutputExists)
+
+	require.NoError(t, os.Remove(output))
+
+	// the metadata is not overwritten either
+	require.ErrorIs(t, st.buildRunE(cmd, []string{"run", filepath.Join("testdata", "script.js")}), errOutputExists)
+	require.NoFileExists(t, output)
+
+	st.force = true
+	st.link = true
+
+	require.NoError(t, st.buildRunE(cmd, []string{"run", filepath.Join("testdata", "script.js")}))
+
+	data, err = os.ReadFile(output)
+	require.NoError(t, err)
+	require.Equal(t, "k6", string(data))
+}
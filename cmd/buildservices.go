@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/grafana/k6exec"
+)
+
+// structure of an element of the build services file
+type buildServiceConfig struct {
+	URL         string   `json:"url"`
+	Token       string   `json:"token"`
+	TokenEnv    string   `json:"token_env"`
+	TrustedKeys []string `json:"trusted_keys"`
+}
+
+// loadBuildServices loads the ordered list of build services from the given file.
+// The token of a build service can be given directly or by the name of the environment variable containing it.
+func loadBuildServices(path string) ([]k6exec.BuildService, error) {
+	buffer, err := os.ReadFile(path) //nolint:forbidigo,gosec
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build services file %q: %w", path, err)
+	}
+
+	var configs []buildServiceConfig
+
+	if err := json.Unmarshal(buffer, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse build services file %q: %w", path, err)
+	}
+
+	services := make([]k6exec.BuildService, 0, len(configs))
+
+	for _, config := range configs {
+		if len(config.URL) == 0 {
+			return nil, fmt.Errorf("missing build service URL in %q", path)
+		}
+
+		token := config.Token
+		if len(token) == 0 && len(config.TokenEnv) > 0 {
+			token = os.Getenv(config.TokenEnv) //nolint:forbidigo
+		}
+
+		keys, err := parsePublicKeys(config.TrustedKeys)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted key of %q in %q: %w", config.URL, path, err)
+		}
+
+		services = append(services, k6exec.BuildService{URL: config.URL, Token: token, TrustedKeys: keys})
+	}
+
+	return services, nil
+}
+
+// parsePublicKeys parses ed25519 public keys, given either in PEM (PKIX) format or base64 encoded.
+func parsePublicKeys(values []string) ([]ed25519.PublicKey, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]ed25519.PublicKey, 0, len(values))
+
+	for _, value := range values {
+		key, err := parsePublicKey(value)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func parsePublicKey(value string) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		if edkey, ok := key.(ed25519.PublicKey); ok {
+			return edkey, nil
+		}
+
+		return nil, errors.New("not an ed25519 public key")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 public key size")
+	}
+
+	return ed25519.PublicKey(key), nil
+}
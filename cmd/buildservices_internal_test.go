@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/k6exec"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loadBuildServices(t *testing.T) {
+	t.Setenv("K6EXEC_TEST_TOKEN", "from-env")
+
+	dir := t.TempDir()
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600)) //nolint:forbidigo
+
+		return path
+	}
+
+	services, err := loadBuildServices(write("valid.json", `[
+  {"url": "https://k6build.example.com", "token": "secret"},
+  {"url": "https://public.example.com", "token_env": "K6EXEC_TEST_TOKEN"},
+  {"url": "https://anonymous.example.com"}
+]`))
+	require.NoError(t, err)
+	require.Equal(t, []k6exec.BuildService{
+		{URL: "https://k6build.example.com", Token: "secret"},
+		{URL: "https://public.example.com", Token: "from-env"},
+		{URL: "https://anonymous.example.com"},
+	}, services)
+
+	_, err = loadBuildServices(write("invalid.json", `{"url": "https://k6build.example.com"}`))
+	require.Error(t, err)
+
+	_, err = loadBuildServices(write("missing_url.json", `[{"token": "secret"}]`))
+	require.Error(t, err)
+
+	_, err = loadBuildServices(filepath.Join(dir, "missing.json"))
+	require.Error(t, err)
+
+	_, err = loadBuildServices(write("invalid_key.json", `[{"url": "https://k6build.example.com", "trusted_keys": ["key"]}]`))
+	require.Error(t, err)
+}
+
+func Test_parsePublicKey(t *testing.T) {
+	t.Parallel()
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+
+	for _, value := range []string{
+		base64.StdEncoding.EncodeToString(pub),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	} {
+		key, err := parsePublicKey(value)
+		require.NoError(t, err)
+		require.Equal(t, pub, key)
+	}
+
+	_, err = parsePublicKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	require.Error(t, err)
+
+	_, err = parsePublicKey("-----BEGIN PUBLIC KEY-----\nAAAA\n-----END PUBLIC KEY-----\n")
+	require.Error(t, err)
+}
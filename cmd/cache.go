@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/grafana/k6exec"
+	"github.com/spf13/cobra"
+)
+
+const cacheHelp = `Manage the cached k6 executables.
+
+The k6 executables provisioned by the launcher are cached. The cached k6 executables can be listed,
+pruned according to the cache limits (--cache-max-size, --cache-max-age) or cleared.
+They include every k6 executable found in the cache directories, even if it was provisioned by another tool.
+
+The cache limits are also applied automatically after each k6 command is run,
+removing the least recently used k6 executables.`
+
+const cacheExample = `  k6exec cache list
+  k6exec cache prune --cache-max-size 2GiB --cache-max-age 168h
+  k6exec cache clear`
+
+var errInvalidSize = errors.New("invalid size")
+
+func newCacheCommand(state *state) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "cache",
+		Short:         "Manage the cached k6 executables",
+		Long:          cacheHelp,
+		Example:       cacheExample,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		Args:          cobra.NoArgs,
+	}
+
+	listCmd := &cobra.Command{
+		Use:           "list",
+		Short:         "List the cached k6 executables, the least recently used first",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		Args:          cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			binaries, err := k6exec.ListCache(&state.Options)
+			if err != nil {
+				return err
+			}
+
+			if state.json {
+				return printCacheJSON(cmd.OutOrStdout(), binaries)
+			}
+
+			return printCacheText(cmd.OutOrStdout(), binaries)
+		},
+	}
+
+	listCmd.Flags().BoolVar(&state.json, "json", false, "print the cached k6 executables in JSON format")
+
+	pruneCmd := &cobra.Command{
+		Use:           "prune",
+		Short:         "Remove the least recently used k6 executables exceeding the cache limits",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		Args:          cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if state.CacheMaxSize <= 0 && state.CacheMaxAge <= 0 {
+				return errors.New("no cache limit specified, use --cache-max-size or --cache-max-age")
+			}
+
+			removed, err := k6exec.PruneCache(&state.Options)
+
+			return printRemoved(cmd.OutOrStdout(), removed, err)
+		},
+	}
+
+	clearCmd := &cobra.Command{
+		Use:           "clear",
+		Short:         "Remove all the cached k6 executables",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		Args:          cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			removed, err := k6exec.ClearCache(&state.Options)
+
+			return printRemoved(cmd.OutOrStdout(), removed, err)
+		},
+	}
+
+	cmd.AddCommand(listCmd, pruneCmd, clearCmd)
+
+	return cmd
+}
+
+type cachedBinaryJSON struct {
+	Path         string            `json:"path"`
+	Dependencies map[string]string `json:"dependencies"`
+	Platform     string            `json:"platform"`
+	Size         int64             `json:"size"`
+	LastUsed     time.Time         `json:"last_used"`
+}
+
+func printCacheJSON(out io.Writer, binaries []k6exec.CachedBinary) error {
+	items := make([]cachedBinaryJSON, 0, len(binaries))
+
+	for _, binary := range binaries {
+		items = append(items, cachedBinaryJSON(binary))
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(items)
+}
+
+func printCacheText(out io.Writer, binaries []k6exec.CachedBinary) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	_, err := fmt.Fprintln(writer, "DEPENDENCIES\tPLATFORM\tSIZE\tLAST USED\tPATH")
+	if err != nil {
+		return err
+	}
+
+	var total int64
+
+	for _, binary := range binaries {
+		total += binary.Size
+
+		_, err = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n",
+			formatDependencies(binary.Dependencies),
+			binary.Platform,
+			k6exec.FormatSize(binary.Size),
+			binary.LastUsed.Local().Format(time.DateTime),
+			binary.Path,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "\n%d cached k6 executables, %s in total\n", len(binaries), k6exec.FormatSize(total))
+
+	return err
+}
+
+func printRemoved(out io.Writer, removed []k6exec.CachedBinary, err error) error {
+	var total int64
+
+	for _, binary := range removed {
+		total += binary.Size
+
+		_, perr := fmt.Fprintf(out, "removed %s (%s)\n", binary.Path, formatDependencies(binary.Dependencies))
+		if perr != nil {
+			return perr
+		}
+	}
+
+	_, perr := fmt.Fprintf(out, "%d cached k6 executables removed, %s freed\n", len(removed), k6exec.FormatSize(total))
+	if perr != nil {
+		return perr
+	}
+
+	return err
+}
+
+func formatDependencies(deps map[string]string) string {
+	items := make([]string, 0, len(deps))
+
+	for _, name := range slices.Sorted(maps.Keys(deps)) {
+		items = append(items, name+" "+deps[name])
+	}
+
+	return strings.Join(items, ", ")
+}
+
+//nolint:gochecknoglobals
+var sizeMultipliers = map[string]int64{
+	"": 1, "B": 1,
+	"K": 1 << 10, "KiB": 1 << 10, "KB": 1e3,
+	"M": 1 << 20, "MiB": 1 << 20, "MB": 1e6,
+	"G": 1 << 30, "GiB": 1 << 30, "GB": 1e9,
+	"T": 1 << 40, "TiB": 1 << 40, "TB": 1e12,
+}
+
+// parseSize parses a size in bytes with an optional unit suffix. The K, M, G, T and KiB, MiB, GiB, TiB
+// suffixes are binary (e.g. 500M, 2GiB), the KB, MB, GB, TB suffixes are decimal (e.g. 2GB is 2*10^9 bytes).
+func parseSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+
+	idx := strings.IndexFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	if idx < 0 {
+		idx = len(value)
+	}
+
+	multiplier, found := sizeMultipliers[strings.TrimSpace(value[idx:])]
+
+	size, err := strconv.ParseInt(value[:idx], 10, 64)
+	if err != nil || !found {
+		return 0, fmt.Errorf("%w: %q", errInvalidSize, value)
+	}
+
+	if size > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("%w: %q is too large", errInvalidSize, value)
+	}
+
+	return size * multiplier, nil
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/grafana/k6exec"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseSize(t *testing.T) {
+	t.Parallel()
+
+	for value, expected := range map[string]int64{
+		"0":      0,
+		"1024":   1024,
+		"100B":   100,
+		"1K":     1024,
+		"2KiB":   2048,
+		"500MB":  500e6,
+		"500MiB": 500 << 20,
+		"2GiB":   2 << 30,
+		"2GB":    2e9,
+		" 1 T  ": 1 << 40,
+	} {
+		size, err := parseSize(value)
+		require.NoError(t, err, value)
+		require.Equal(t, expected, size, value)
+	}
+
+	for _, value := range []string{"", "MB", "-1", "1KK", "1X", "1.5G", "1 Ki", "8388608T", "99999999999999999999"} {
+		_, err := parseSize(value)
+		require.ErrorIs(t, err, errInvalidSize, value)
+	}
+}
+
+func Test_cacheCommand(t *testing.T) {
+	t.Parallel()
+
+	st := &state{levelVar: new(slog.LevelVar), Options: k6exec.Options{CacheDir: t.TempDir(), BinaryCacheDir: t.TempDir()}}
+
+	run := func(args ...string) (string, error) {
+		cmd := newCacheCommand(st)
+
+		var out bytes.Buffer
+
+		cmd.SetOut(&out)
+		cmd.SetArgs(args)
+
+		err := cmd.Execute()
+
+		return out.String(), err
+	}
+
+	out, err := run("list")
+	require.NoError(t, err)
+	require.Contains(t, out, "0 cached k6 executables")
+
+	out, err = run("list", "--json")
+	require.NoError(t, err)
+
+	var items []cachedBinaryJSON
+
+	require.NoError(t, json.Unmarshal([]byte(out), &items))
+	require.Empty(t, items)
+
+	_, err = run("prune")
+	require.Error(t, err)
+
+	st.CacheMaxSize = 1
+
+	out, err = run("prune")
+	require.NoError(t, err)
+	require.Contains(t, out, "0 cached k6 executables removed")
+
+	out, err = run("clear")
+	require.NoError(t, err)
+	require.Contains(t, out, "0 cached k6 executables removed")
+}
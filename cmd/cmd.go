@@ -49,6 +49,11 @@ func New(levelVar *slog.LevelVar) *cobra.Command {
 		root.AddCommand(newSubcommand(name, state))
 	}
 
+	root.AddCommand(newDepsCommand(state))
+	root.AddCommand(newCacheCommand(state))
+	root.AddCommand(newProvisionCommand(state))
+	root.AddCommand(newBuildCommand(state))
+
 	flags := root.PersistentFlags()
 
 	flags.StringVar(
@@ -57,6 +62,51 @@ func New(levelVar *slog.LevelVar) *cobra.Command {
 		state.buildServiceURL,
 		"URL of the k6 build service to be used",
 	)
+	flags.StringVar(&state.buildServiceAuth, "build-service-auth", "",
+		"token to authenticate with the build service (default K6_BUILD_SERVICE_AUTH)")
+	flags.StringVar(&state.credentialHelper, "credential-helper", "",
+		"command printing the token to authenticate with the build service (default K6EXEC_CREDENTIAL_HELPER)")
+	flags.StringArrayVar(&state.trustedKeys, "trusted-key", nil,
+		"public key trusted to sign the k6 binary (can be repeated)")
+	flags.StringVar(&state.buildServices, "build-services", "", "file containing the build services to be used in order")
+	flags.StringVar(&state.DownloadAuth, "download-auth", "",
+		"authorization header to download the k6 binary (default K6_DOWNLOAD_AUTH)")
+	flags.StringArrayVar(&state.downloadHeaders, "download-header", nil,
+		"header to download the k6 binary, e.g. \"X-Api-Key: secret\" (can be repeated)")
+	flags.StringVar(&state.ProxyURL, "proxy-url", "",
+		"URL of the HTTP proxy used to reach the build service (default K6EXEC_PROXY_URL)")
+	flags.StringVar(&state.CACertFile, "ca-cert", "",
+		"PEM file of additional trusted CA certificates (default K6EXEC_CA_CERT)")
+	flags.StringVar(&state.ClientCertFile, "client-cert", "",
+		"PEM file of the client certificate for mutual TLS (default K6EXEC_CLIENT_CERT)")
+	flags.StringVar(&state.ClientKeyFile, "client-key", "",
+		"PEM file of the client certificate key (default K6EXEC_CLIENT_KEY)")
+	flags.BoolVar(&state.LocalBuild, "local-build", false, "build k6 locally if the build service is not available")
+	flags.StringToStringVar(&state.LocalModules, "local-module", nil,
+		"Go module of an extension for the local build, e.g. k6/x/faker=github.com/grafana/xk6-faker (can be repeated)")
+	flags.StringVar(&state.GoProxy, "goproxy", "",
+		"GOPROXY used by the local build (default GOPROXY of the Go environment)")
+	flags.StringVar(&state.GoModCache, "gomodcache", "",
+		"GOMODCACHE used by the local build (default GOMODCACHE of the Go environment)")
+	flags.StringVar(&state.Platform, "platform", "",
+		"platform of the k6 binary to be provisioned, e.g. linux/arm64 (default current platform)")
+	flags.BoolVar(&state.offline, "offline", false, "use only the already cached k6 binaries (default K6EXEC_OFFLINE)")
+	flags.StringVar(&state.cacheMaxSize, "cache-max-size", "",
+		"maximum size of the cached k6 binaries, e.g. 2GiB (default K6EXEC_CACHE_MAX_SIZE)")
+	flags.DurationVar(&state.CacheMaxAge, "cache-max-age", 0,
+		"maximum time since a cached k6 binary was last used (default K6EXEC_CACHE_MAX_AGE)")
+	flags.DurationVar(&state.LockTimeout, "lock-timeout", 0,
+		"maximum time to wait for another process provisioning the same k6 binary (default K6EXEC_LOCK_TIMEOUT or 15m)")
+	flags.StringVar(&state.lockfile, "lockfile", "", "path of the lockfile (default k6exec.lock next to the manifest)")
+	flags.BoolVar(&state.updateLockfile, "update-lockfile", false, "resolve the dependencies and write the lockfile")
+	flags.BoolVar(&state.frozenLockfile, "frozen-lockfile", false, "require an up-to-date lockfile")
+	flags.StringVar(&state.mergePolicy, "merge-policy", "",
+		"version constraint merge policy: strict, override or intersect (default strict)")
+	flags.BoolVar(&state.replaceProcess, "exec", false,
+		"replace the launcher process with k6 instead of running k6 as a child process "+
+			"(default K6EXEC_EXEC or true on Linux)")
+	flags.DurationVar(&state.gracePeriod, "grace-period", 0,
+		"time to wait for k6 to stop after forwarding a signal, before killing it (default K6EXEC_GRACE_PERIOD or 1m)")
 	flags.BoolVarP(&state.verbose, "verbose", "v", false, "enable verbose logging")
 	flags.BoolVarP(&state.quiet, "quiet", "q", false, "disable progress updates")
 	flags.BoolVar(&state.nocolor, "no-color", false, "disable colored output")
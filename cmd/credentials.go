@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const credentialHelperTimeout = 30 * time.Second
+
+// credentialSource supplies the build service token. It returns an empty token if it has none.
+type credentialSource struct {
+	name  string
+	token func() (string, error)
+}
+
+// buildServiceCredential returns the function resolving the build service token from the credential sources.
+// The sources are queried once, the first time the token is needed.
+func (s *state) buildServiceCredential(cmd *cobra.Command) func(context.Context) (string, error) {
+	var (
+		once  sync.Once
+		token string
+		err   error
+	)
+
+	return func(ctx context.Context) (string, error) {
+		once.Do(func() {
+			if token, err = resolveCredential(s.credentialSources(ctx, cmd)); err != nil {
+				err = fmt.Errorf("build service credential: %w", err)
+			}
+		})
+
+		return token, err
+	}
+}
+
+// credentialSources returns the sources of the build service token, in order of precedence.
+func (s *state) credentialSources(ctx context.Context, cmd *cobra.Command) []credentialSource {
+	return []credentialSource{
+		{name: "--build-service-auth flag", token: func() (string, error) { return s.buildServiceAuth, nil }},
+		envCredential("K6_BUILD_SERVICE_AUTH"),
+		fileCredential("K6_BUILD_SERVICE_AUTH_FILE"),
+		envCredential("K6_CLOUD_TOKEN"),
+		fileCredential("K6_CLOUD_TOKEN_FILE"),
+		{name: "credential helper", token: func() (string, error) {
+			helper := s.credentialHelper
+			if len(helper) == 0 {
+				helper = os.Getenv("K6EXEC_CREDENTIAL_HELPER") //nolint:forbidigo
+			}
+
+			return runCredentialHelper(ctx, helper, s.Options.BuildServiceURL)
+		}},
+		{name: "netrc", token: func() (string, error) { return netrcCredential(s.Options.BuildServiceURL) }},
+		{name: "k6 config", token: func() (string, error) {
+			// allow overriding the config file for testing
+			configFile := s.configFile
+			if configFile == "" {
+				// check if the command has a 'config' flag and get the value
+				var err error
+
+				if configFile, err = getFlagValue(cmd, "config"); err != nil {
+					return "", err
+				}
+			}
+
+			config, err := loadConfig(configFile)
+			if err != nil {
+				return "", err
+			}
+
+			return config.Collectors.Cloud.Token, nil
+		}},
+	}
+}
+
+// resolveCredential returns the token supplied by the first source having one.
+// The token itself is never logged, only its source.
+func resolveCredential(sources []credentialSource) (string, error) {
+	for _, source := range sources {
+		token, err := source.token()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", source.name, err)
+		}
+
+		if len(token) > 0 {
+			slog.Debug("build service token found", "source", source.name)
+
+			return token, nil
+		}
+	}
+
+	slog.Debug("no build service token found")
+
+	return "", nil
+}
+
+func envCredential(name string) credentialSource {
+	return credentialSource{name: name, token: func() (string, error) {
+		return os.Getenv(name), nil //nolint:forbidigo
+	}}
+}
+
+// fileCredential reads the token from the file named by the environment variable (e.g. a mounted secret).
+func fileCredential(name string) credentialSource {
+	return credentialSource{name: name, token: func() (string, error) {
+		filename := os.Getenv(name) //nolint:forbidigo
+		if len(filename) == 0 {
+			return "", nil
+		}
+
+		data, err := os.ReadFile(filename) //nolint:forbidigo,gosec
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSpace(string(data)), nil
+	}}
+}
+
+// runCredentialHelper runs the helper command through the shell (cmd on Windows). It prints the token
+// (or a JSON object with a token property) to its standard output.
+// The URL of the build service is passed in the K6_BUILD_SERVICE_URL environment variable.
+func runCredentialHelper(ctx context.Context, helper string, serviceURL string) (string, error) {
+	if len(strings.TrimSpace(helper)) == 0 {
+		return "", nil
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, credentialHelperTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", helper) //nolint:gosec
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", helper) //nolint:gosec
+	}
+
+	cmd.Env = append(os.Environ(), "K6_BUILD_SERVICE_URL="+serviceURL) //nolint:forbidigo
+	cmd.Stderr = os.Stderr                                             //nolint:forbidigo
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	out = bytes.TrimSpace(out)
+
+	if bytes.HasPrefix(out, []byte("{")) {
+		var credential struct {
+			Token string `json:"token"`
+		}
+
+		if err := json.Unmarshal(out, &credential); err != nil {
+			return "", err
+		}
+
+		return credential.Token, nil
+	}
+
+	return string(out), nil
+}
+
+// netrcCredential returns the password of the netrc entry of the build service host (or the default entry).
+// The netrc file is named by the NETRC environment variable, or it is .netrc (_netrc on Windows)
+// in the home directory. A missing netrc file supplies no token.
+func netrcCredential(serviceURL string) (string, error) {
+	parsed, err := url.Parse(serviceURL)
+	if err != nil || len(parsed.Hostname()) == 0 {
+		return "", nil //nolint:nilerr
+	}
+
+	filename := os.Getenv("NETRC") //nolint:forbidigo
+	if len(filename) == 0 {
+		home, err := os.UserHomeDir() //nolint:forbidigo
+		if err != nil {
+			return "", nil //nolint:nilerr
+		}
+
+		name := ".netrc"
+		if runtime.GOOS == "windows" {
+			name = "_netrc"
+		}
+
+		filename = filepath.Join(home, name)
+	}
+
+	data, err := os.ReadFile(filename)  //nolint:forbidigo,gosec
+	if errors.Is(err, os.ErrNotExist) { //nolint:forbidigo
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return parseNetrc(data, parsed.Hostname()), nil
+}
+
+// parseNetrc returns the password of the machine entry (or the default entry) of the netrc content.
+func parseNetrc(data []byte, host string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Split(bufio.ScanWords)
+
+	var (
+		fallback             string
+		inMachine, inDefault bool
+	)
+
+	for scanner.Scan() {
+		switch scanner.Text() {
+		case "machine":
+			inMachine = scanner.Scan() && scanner.Text() == host
+			inDefault = false
+		case "default":
+			inMachine, inDefault = false, true
+		case "login", "account":
+			scanner.Scan()
+		case "password":
+			if !scanner.Scan() {
+				return fallback
+			}
+
+			if inMachine {
+				return scanner.Text()
+			}
+
+			if inDefault && len(fallback) == 0 {
+				fallback = scanner.Text()
+			}
+		case "macdef":
+			// macro definitions are not supported, they end the entries
+			inMachine, inDefault = false, false
+		}
+	}
+
+	return fallback
+}
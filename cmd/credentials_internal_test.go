@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseNetrc(t *testing.T) {
+	t.Parallel()
+
+	netrc := []byte(`
+machine example.com login user password secret
+machine build.example.com
+  login user
+  password build-token
+
+default login anonymous password default-token
+`)
+
+	require.Equal(t, "build-token", parseNetrc(netrc, "build.example.com"))
+	require.Equal(t, "secret", parseNetrc(netrc, "example.com"))
+	require.Equal(t, "default-token", parseNetrc(netrc, "other.example.com"))
+	require.Empty(t, parseNetrc([]byte("machine example.com login password password"), "other.example.com"))
+	require.Equal(t, "password", parseNetrc([]byte("machine example.com login password password password"), "example.com"))
+}
+
+func Test_runCredentialHelper(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on windows")
+	}
+
+	dir := t.TempDir()
+
+	helper := func(name string, script string) string {
+		path := filepath.Join(dir, name)
+
+		require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o700)) //nolint:forbidigo
+
+		return path
+	}
+
+	token, err := runCredentialHelper(context.Background(), helper("plain", `echo "token-for-$K6_BUILD_SERVICE_URL"`), "url")
+	require.NoError(t, err)
+	require.Equal(t, "token-for-url", token)
+
+	token, err = runCredentialHelper(context.Background(), helper("json", `echo '{"token": "json-token"}'`)+" arg", "url")
+	require.NoError(t, err)
+	require.Equal(t, "json-token", token)
+
+	_, err = runCredentialHelper(context.Background(), helper("failing", "exit 1"), "url")
+	require.Error(t, err)
+
+	// the helper is run by the shell
+	token, err = runCredentialHelper(context.Background(), `echo 'shell token' | tr ' ' '-'`, "url")
+	require.NoError(t, err)
+	require.Equal(t, "shell-token", token)
+
+	token, err = runCredentialHelper(context.Background(), "", "url")
+	require.NoError(t, err)
+	require.Empty(t, token)
+}
+
+func Test_credentialSources(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600)) //nolint:forbidigo
+
+		return path
+	}
+
+	for _, name := range []string{
+		"K6_BUILD_SERVICE_AUTH", "K6_BUILD_SERVICE_AUTH_FILE", "K6_CLOUD_TOKEN", "K6_CLOUD_TOKEN_FILE",
+		"K6EXEC_CREDENTIAL_HELPER",
+	} {
+		t.Setenv(name, "")
+	}
+
+	t.Setenv("NETRC", filepath.Join(dir, "missing"))
+
+	st := &state{levelVar: new(slog.LevelVar), configFile: filepath.Join("testdata", "config", "valid.json")}
+	st.Options.BuildServiceURL = "https://build.example.com/api"
+
+	resolve := func() string {
+		t.Helper()
+
+		token, err := resolveCredential(st.credentialSources(context.Background(), &cobra.Command{}))
+		require.NoError(t, err)
+
+		return token
+	}
+
+	// from the lowest to the highest precedence
+	require.Equal(t, "token", resolve())
+
+	t.Setenv("NETRC", write("netrc", "machine build.example.com password netrc-token\n"))
+	require.Equal(t, "netrc-token", resolve())
+
+	if runtime.GOOS != "windows" {
+		helper := write("helper", "#!/bin/sh\necho helper-token\n")
+		require.NoError(t, os.Chmod(helper, 0o700)) //nolint:forbidigo
+
+		t.Setenv("K6EXEC_CREDENTIAL_HELPER", helper)
+		require.Equal(t, "helper-token", resolve())
+	}
+
+	t.Setenv("K6_CLOUD_TOKEN_FILE", write("cloud-token", "cloud-file-token\n"))
+	require.Equal(t, "cloud-file-token", resolve())
+
+	t.Setenv("K6_CLOUD_TOKEN", "cloud-token")
+	require.Equal(t, "cloud-token", resolve())
+
+	t.Setenv("K6_BUILD_SERVICE_AUTH_FILE", write("auth", "  auth-file-token\n"))
+	require.Equal(t, "auth-file-token", resolve())
+
+	t.Setenv("K6_BUILD_SERVICE_AUTH", "auth-token")
+	require.Equal(t, "auth-token", resolve())
+
+	st.buildServiceAuth = "flag-token"
+	require.Equal(t, "flag-token", resolve())
+
+	// errors of the sources are not ignored
+	st.buildServiceAuth = ""
+	t.Setenv("K6_BUILD_SERVICE_AUTH", "")
+	t.Setenv("K6_BUILD_SERVICE_AUTH_FILE", filepath.Join(dir, "missing"))
+
+	_, err := resolveCredential(st.credentialSources(context.Background(), &cobra.Command{}))
+	require.ErrorContains(t, err, "K6_BUILD_SERVICE_AUTH_FILE")
+}
+
+func Test_buildServiceCredential(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on windows")
+	}
+
+	for _, name := range []string{"K6_BUILD_SERVICE_AUTH", "K6_BUILD_SERVICE_AUTH_FILE", "K6_CLOUD_TOKEN", "K6_CLOUD_TOKEN_FILE"} {
+		t.Setenv(name, "")
+	}
+
+	counter := filepath.Join(t.TempDir(), "counter")
+
+	st := &state{levelVar: new(slog.LevelVar), credentialHelper: "echo run >> " + counter + " && echo helper-token"}
+
+	credential := st.buildServiceCredential(&cobra.Command{})
+
+	// the helper is not run until the token is needed
+	require.NoFileExists(t, counter)
+
+	for range 2 {
+		token, err := credential(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "helper-token", token)
+	}
+
+	// the sources are queried once
+	data, err := os.ReadFile(counter) //nolint:forbidigo
+	require.NoError(t, err)
+	require.Equal(t, "run\n", string(data))
+}
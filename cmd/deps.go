@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/grafana/k6exec"
+	"github.com/spf13/cobra"
+)
+
+const depsHelp = `Print the dependencies of a k6 command.
+
+The dependencies of the given k6 command line are analyzed the same way as when running k6,
+but the k6 executable is not provisioned. For each dependency, the sources of its version constraints
+are also printed (script pragma, script import, manifest, environment variable, output or archive).
+
+The flags of this command must precede the k6 command line, flags following it are passed to k6.
+A "--" separator can also be used to end the flags of this command.`
+
+const depsExample = `  k6exec deps run script.js
+  k6exec deps --json run --out json=results.json script.js`
+
+func newDepsCommand(state *state) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "deps [flags] [--] [k6 command]",
+		Short:         "Print the dependencies of a k6 command",
+		Long:          depsHelp,
+		Example:       depsExample,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE:          state.depsRunE,
+	}
+
+	cmd.Flags().BoolVar(&state.json, "json", false, "print the dependencies in JSON format")
+	// the flags following the k6 command (e.g. --out) belong to the k6 command line
+	cmd.Flags().SetInterspersed(false)
+
+	return cmd
+}
+
+func (s *state) depsRunE(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	analysis, err := k6exec.Analyze(ctx, args, &s.Options)
+	if err != nil {
+		return err
+	}
+
+	if s.json {
+		return printDepsJSON(cmd.OutOrStdout(), analysis)
+	}
+
+	return printDepsText(cmd.OutOrStdout(), analysis)
+}
+
+type dependencyJSON struct {
+	Name        string                    `json:"name"`
+	Constraints string                    `json:"constraints"`
+	Sources     []k6exec.DependencySource `json:"sources"`
+}
+
+func printDepsJSON(out io.Writer, analysis *k6exec.Analysis) error {
+	deps := make([]dependencyJSON, 0, len(analysis.Dependencies))
+
+	for _, dep := range analysis.Dependencies.Sorted() {
+		deps = append(deps, dependencyJSON{
+			Name:        dep.Name,
+			Constraints: dep.GetConstraints().String(),
+			Sources:     analysis.Sources[dep.Name],
+		})
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(deps)
+}
+
+func printDepsText(out io.Writer, analysis *k6exec.Analysis) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	_, err := fmt.Fprintln(writer, "DEPENDENCY\tCONSTRAINTS\tSOURCE\tSOURCE CONSTRAINTS\tFROM")
+	if err != nil {
+		return err
+	}
+
+	for _, dep := range analysis.Dependencies.Sorted() {
+		name, constraints := dep.Name, dep.GetConstraints().String()
+
+		for _, src := range analysis.Sources[dep.Name] {
+			_, err = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", name, constraints, src.Origin, src.Constraints, src.Name)
+			if err != nil {
+				return err
+			}
+
+			// print the dependency only in the first line of its sources
+			name, constraints = "", ""
+		}
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/grafana/k6exec"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_depsRunE(t *testing.T) {
+	t.Parallel()
+
+	script := filepath.Join("testdata", "script.js")
+
+	abs, err := filepath.Abs(script)
+	require.NoError(t, err)
+
+	st := &state{
+		levelVar: new(slog.LevelVar),
+		Options: k6exec.Options{
+			Env:      k6deps.Source{Ignore: true},
+			Manifest: k6deps.Source{Ignore: true},
+		},
+	}
+
+	cmd := newDepsCommand(st)
+
+	var out bytes.Buffer
+
+	cmd.SetOut(&out)
+
+	require.NoError(t, st.depsRunE(cmd, []string{"run", "--vus", "2", script}))
+	require.Contains(t, out.String(), "DEPENDENCY")
+	require.Contains(t, out.String(), "k6  ")
+	require.Contains(t, out.String(), "pragma")
+	require.Contains(t, out.String(), abs)
+
+	out.Reset()
+
+	st.json = true
+
+	require.NoError(t, st.depsRunE(cmd, []string{"run", script}))
+
+	var deps []dependencyJSON
+
+	require.NoError(t, json.Unmarshal(out.Bytes(), &deps))
+	require.Equal(t, []dependencyJSON{{
+		Name:        "k6",
+		Constraints: ">=v0.52",
+		Sources: []k6exec.DependencySource{
+			{Origin: k6exec.OriginPragma, Name: abs, Constraints: ">=v0.52"},
+		},
+	}}, deps)
+
+	require.Error(t, st.depsRunE(cmd, []string{"run", filepath.Join("testdata", "invalid_constraint.js")}))
+}
+
+func Test_newDepsCommand(t *testing.T) {
+	t.Parallel()
+
+	script := filepath.Join("testdata", "script.js")
+
+	st := &state{
+		levelVar: new(slog.LevelVar),
+		Options: k6exec.Options{
+			Env:      k6deps.Source{Ignore: true},
+			Manifest: k6deps.Source{Ignore: true},
+		},
+	}
+
+	cmd := newDepsCommand(st)
+
+	var out bytes.Buffer
+
+	cmd.SetOut(&out)
+
+	// the k6 flags following the k6 command are not parsed as flags of the deps command
+	cmd.SetArgs([]string{"--json", "run", "--out", "json=results.json", "--vus", "2", script})
+
+	require.NoError(t, cmd.Execute())
+
+	var deps []dependencyJSON
+
+	require.NoError(t, json.Unmarshal(out.Bytes(), &deps))
+	require.Len(t, deps, 1)
+	require.Equal(t, "k6", deps[0].Name)
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+//nolint:forbidigo
+func Test_execProcess(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		require.ErrorIs(t, execProcess(exec.Command("k6")), errors.ErrUnsupported)
+
+		return
+	}
+
+	// the test binary is run again, to be replaced by the shell
+	if os.Getenv("K6EXEC_TEST_EXEC") == "1" {
+		err := execProcess(exec.Command("/bin/sh", "-c", "echo replaced; exit 7"))
+
+		// not reached if the process is replaced
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^Test_execProcess$") //nolint:gosec
+	cmd.Env = append(os.Environ(), "K6EXEC_TEST_EXEC=1")
+
+	out, err := cmd.Output()
+
+	var eerr *exec.ExitError
+
+	require.ErrorAs(t, err, &eerr)
+	require.Equal(t, 7, eerr.ExitCode())
+	require.Equal(t, "replaced\n", string(out))
+}
+
+func Test_state_replace(t *testing.T) {
+	t.Parallel()
+
+	cleaned := false
+
+	st := &state{
+		cmd: exec.Command("k6"),
+		cleanup: func() error {
+			cleaned = true
+
+			return nil
+		},
+	}
+
+	st.cmd.Stdin = bytes.NewReader([]byte("export default function() {}"))
+	st.cmd.Stdout = os.Stdout //nolint:forbidigo
+	st.cmd.Stderr = os.Stderr //nolint:forbidigo
+
+	// the replacement is not attempted
+	require.NoError(t, st.replace())
+	require.False(t, cleaned)
+}
+
+//nolint:forbidigo
+func Test_state_runE_replace(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the process cannot be replaced on windows")
+	}
+
+	// the test binary is run again, to be replaced by the shell
+	if os.Getenv("K6EXEC_TEST_EXEC") == "runE" {
+		st := &state{
+			cmd:            exec.Command("/bin/sh", "-c", "echo replaced; exit 7"),
+			replaceProcess: true,
+			cleanup: func() error {
+				_, err := os.Stdout.WriteString("cleaned\n")
+
+				return err
+			},
+		}
+
+		st.cmd.Stdin, st.cmd.Stdout, st.cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+		err := st.runE(nil, nil)
+
+		// not reached if the process is replaced
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^Test_state_runE_replace$") //nolint:gosec
+	cmd.Env = append(os.Environ(), "K6EXEC_TEST_EXEC=runE")
+
+	out, err := cmd.Output()
+
+	var eerr *exec.ExitError
+
+	require.ErrorAs(t, err, &eerr)
+	require.Equal(t, 7, eerr.ExitCode())
+	require.Equal(t, "cleaned\nreplaced\n", string(out))
+
+	// k6 is run as a child process if the replacement is not attempted
+	st := &state{
+		cmd:            exec.Command("/bin/sh", "-c", "exit 7"),
+		replaceProcess: true,
+		cleanup:        func() error { return nil },
+	}
+
+	st.cmd.Stdin = bytes.NewReader(nil)
+	st.cmd.Stdout, st.cmd.Stderr = os.Stdout, os.Stderr
+
+	require.ErrorAs(t, st.runE(nil, nil), &eerr)
+	require.Equal(t, 7, eerr.ExitCode())
+}
+
+//nolint:forbidigo
+func Test_state_runE_replace_failed(t *testing.T) {
+	t.Parallel()
+
+	cleanups := 0
+
+	// the replacement fails, as the executable is missing
+	st := &state{
+		cmd:            exec.Command(filepath.Join(t.TempDir(), "k6")),
+		replaceProcess: true,
+		cleanup: func() error {
+			cleanups++
+
+			return nil
+		},
+	}
+
+	st.cmd.Stdin, st.cmd.Stdout, st.cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	require.Error(t, st.runE(nil, nil))
+	require.Equal(t, 1, cleanups)
+}
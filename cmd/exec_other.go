@@ -0,0 +1,13 @@
+//go:build !unix
+
+package cmd
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// execProcess is not supported on this platform, the command is run as a child process instead.
+func execProcess(_ *exec.Cmd) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// execProcess replaces the current process with the command. It returns only if the replacement fails.
+func execProcess(cmd *exec.Cmd) error {
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ() //nolint:forbidigo
+	}
+
+	return syscall.Exec(cmd.Path, cmd.Args, env) //nolint:gosec
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/grafana/k6deps"
+	"github.com/grafana/k6exec"
+	"github.com/spf13/cobra"
+)
+
+const provisionHelp = `Provision the k6 executable for a k6 command, without running k6.
+
+The dependencies of the given k6 command line are analyzed the same way as when running k6
+(script, manifest, environment variable, lockfile), and the k6 executable satisfying them is provisioned
+in the cache. Alternatively, the dependencies can be given directly using the --deps flag.
+Without a k6 command line and --deps, the dependencies are taken from the manifest and the environment variable.
+
+The path and the SHA-256 checksum of the k6 executable are printed, in the format of the sha256sum command.
+It can be used to provision k6 executables ahead of time, e.g. when building container images
+or priming CI caches. Using the --platform flag, the k6 executable is provisioned for another platform
+(e.g. linux/arm64), to be copied into a container image.
+
+The flags of this command must precede the k6 command line, flags following it are passed to k6.
+A "--" separator can also be used to end the flags of this command.`
+
+const provisionExample = `  k6exec provision run script.js
+  k6exec provision --json run --out json=results.json script.js
+  k6exec provision --deps "k6>0.54;k6/x/faker>0.4.0"
+  k6exec provision --platform linux/arm64 run script.js`
+
+func newProvisionCommand(state *state) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "provision [flags] [--] [k6 command]",
+		Short:         "Provision the k6 executable for a k6 command, without running k6",
+		Long:          provisionHelp,
+		Example:       provisionExample,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE:          state.provisionRunE,
+	}
+
+	cmd.Flags().BoolVar(&state.json, "json", false, "print the provisioned k6 executable in JSON format")
+	cmd.Flags().StringVar(&state.deps, "deps", "", "dependencies to be provisioned, e.g. \"k6>0.54;k6/x/faker*\"")
+	// the flags following the k6 command (e.g. --out) belong to the k6 command line
+	cmd.Flags().SetInterspersed(false)
+
+	return cmd
+}
+
+func (s *state) provisionRunE(cmd *cobra.Command, args []string) error {
+	binary, err := s.provisionBinary(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	if s.json {
+		return printBinaryJSON(cmd.OutOrStdout(), binary, binary.Path, s.Platform)
+	}
+
+	_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s  %s\n", binary.Checksum, binary.Path)
+
+	return err
+}
+
+// provisionBinary provisions the k6 executable for the k6 command line, or for the dependencies given by --deps.
+func (s *state) provisionBinary(cmd *cobra.Command, args []string) (*k6exec.Binary, error) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s.setProgress(int(os.Stderr.Fd())) //nolint:forbidigo
+
+	if len(s.deps) == 0 {
+		return k6exec.Provision(ctx, args, &s.Options)
+	}
+
+	if len(args) > 0 {
+		return nil, errors.New("--deps cannot be used together with a k6 command")
+	}
+
+	var deps k6deps.Dependencies
+
+	if err := deps.UnmarshalText([]byte(s.deps)); err != nil {
+		return nil, fmt.Errorf("invalid dependencies: %w", err)
+	}
+
+	return k6exec.ProvisionDependencies(ctx, deps, &s.Options)
+}
+
+type binaryJSON struct {
+	Path         string            `json:"path"`
+	Checksum     string            `json:"checksum"`
+	Platform     string            `json:"platform"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	Cached       bool              `json:"cached"`
+}
+
+func newBinaryJSON(binary *k6exec.Binary, path string, platform string) binaryJSON {
+	if len(platform) == 0 {
+		platform = runtime.GOOS + "/" + runtime.GOARCH
+	}
+
+	return binaryJSON{
+		Path:         path,
+		Checksum:     binary.Checksum,
+		Platform:     platform,
+		Dependencies: binary.Dependencies,
+		Cached:       binary.Cached,
+	}
+}
+
+func printBinaryJSON(out io.Writer, binary *k6exec.Binary, path string, platform string) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(newBinaryJSON(binary, path, platform))
+}
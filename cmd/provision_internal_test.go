@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/grafana/k6exec"
+	"github.com/grafana/k6exec/internal/k6exectest"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_provisionRunE(t *testing.T) {
+	t.Parallel()
+
+	exe := filepath.Join(t.TempDir(), "k6")
+
+	require.NoError(t, os.WriteFile(exe, []byte("k6"), 0o600)) //nolint:forbidigo
+
+	provisioner := &k6exectest.Provisioner[*k6exec.Binary]{
+		Binary: &k6exec.Binary{Path: exe, Dependencies: map[string]string{"k6": "v0.55.0"}},
+	}
+
+	st := &state{
+		levelVar: new(slog.LevelVar),
+		Options: k6exec.Options{
+			Env:         k6deps.Source{Ignore: true},
+			Manifest:    k6deps.Source{Ignore: true},
+			Provisioner: provisioner,
+		},
+	}
+
+	cmd := newProvisionCommand(st)
+
+	var out bytes.Buffer
+
+	cmd.SetOut(&out)
+
+	require.NoError(t, st.provisionRunE(cmd, []string{"run", filepath.Join("testdata", "script.js")}))
+	require.Equal(t, k6exectest.K6Checksum+"  "+exe+"\n", out.String())
+	require.Equal(t, "k6>=v0.52", provisioner.Deps().String())
+
+	out.Reset()
+
+	st.json = true
+	st.deps = "k6>0.54;k6/x/faker*"
+
+	require.NoError(t, st.provisionRunE(cmd, nil))
+	require.Equal(t, "k6>0.54;k6/x/faker*", provisioner.Deps().String())
+
+	var binary binaryJSON
+
+	require.NoError(t, json.Unmarshal(out.Bytes(), &binary))
+	require.Equal(t, binaryJSON{
+		Path:         exe,
+		Checksum:     k6exectest.K6Checksum,
+		Platform:     runtime.GOOS + "/" + runtime.GOARCH,
+		Dependencies: map[string]string{"k6": "v0.55.0"},
+	}, binary)
+
+	require.Error(t, st.provisionRunE(cmd, []string{"run", "script.js"}))
+
+	st.deps = "k6>>0.54"
+
+	require.Error(t, st.provisionRunE(cmd, nil))
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const defaultGracePeriod = time.Minute
+
+// shutdownSignals are the signals canceling provisioning, or forwarded to k6 once it is started.
+//
+//nolint:gochecknoglobals
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+// watchSignals starts receiving the shutdown signals.
+// Until the returned function is called, a shutdown signal cancels the returned context (e.g. provisioning).
+// The context is canceled by stopSignals, as it also bounds the k6 process started with it.
+func (s *state) watchSignals(ctx context.Context) (context.Context, func()) {
+	s.signals = make(chan os.Signal, 1)
+
+	signal.Notify(s.signals, shutdownSignals...)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.stopWatch = cancel
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		select {
+		case sig := <-s.signals:
+			slog.Info("canceling in response to signal", "signal", sig)
+
+			cancel()
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// stopSignals stops receiving the shutdown signals, and cancels the context returned by watchSignals.
+func (s *state) stopSignals() {
+	if s.signals != nil {
+		signal.Stop(s.signals)
+
+		s.signals = nil
+	}
+
+	if s.stopWatch != nil {
+		s.stopWatch()
+
+		s.stopWatch = nil
+	}
+}
+
+// wait waits for the started k6 process to exit, forwarding the shutdown signals to it,
+// so k6 can stop gracefully (e.g. run teardown and print the summary).
+// After the first signal, k6 is killed if it does not exit within the grace period.
+func (s *state) wait() error {
+	done := make(chan error, 1)
+
+	go func() {
+		done <- s.cmd.Wait()
+	}()
+
+	gracePeriod := s.gracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = defaultGracePeriod
+	}
+
+	var grace <-chan time.Time
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case sig := <-s.signals:
+			if !forwardSignal(sig, s.cmd.Process.Pid) {
+				continue
+			}
+
+			slog.Debug("forwarding signal to k6", "signal", sig)
+
+			if err := s.cmd.Process.Signal(sig); err != nil {
+				slog.Debug("signal not forwarded", "signal", sig, "error", err)
+
+				continue
+			}
+
+			if grace == nil {
+				grace = time.After(gracePeriod)
+			}
+		case <-grace:
+			slog.Warn("k6 did not exit within the grace period, killing it", "grace period", gracePeriod)
+
+			_ = s.cmd.Process.Kill()
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startShell starts the shell script, returning the state running it.
+func startShell(t *testing.T, script string) *state {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not supported on windows")
+	}
+
+	st := &state{cmd: exec.Command("sh", "-c", script)} //nolint:gosec
+
+	require.NoError(t, st.cmd.Start())
+
+	// give the shell time to install its traps
+	time.Sleep(200 * time.Millisecond)
+
+	return st
+}
+
+func Test_state_wait(t *testing.T) {
+	t.Parallel()
+
+	t.Run("exit", func(t *testing.T) {
+		t.Parallel()
+
+		st := startShell(t, "exit 0")
+
+		require.NoError(t, st.wait())
+	})
+
+	t.Run("forward signal", func(t *testing.T) {
+		t.Parallel()
+
+		st := startShell(t, "trap 'exit 3' TERM; while true; do sleep 0.1; done")
+		st.signals = make(chan os.Signal, 1)
+		st.signals <- syscall.SIGTERM
+
+		var eerr *exec.ExitError
+
+		require.ErrorAs(t, st.wait(), &eerr)
+		require.Equal(t, 3, eerr.ExitCode())
+	})
+
+	t.Run("grace period", func(t *testing.T) {
+		t.Parallel()
+
+		st := startShell(t, "trap '' TERM; while true; do sleep 0.1; done")
+		st.gracePeriod = 300 * time.Millisecond
+		st.signals = make(chan os.Signal, 1)
+		st.signals <- syscall.SIGTERM
+
+		start := time.Now()
+
+		var eerr *exec.ExitError
+
+		require.ErrorAs(t, st.wait(), &eerr)
+		require.False(t, eerr.Exited())
+		require.GreaterOrEqual(t, time.Since(start), st.gracePeriod)
+	})
+}
+
+func Test_state_watchSignals(t *testing.T) { //nolint:paralleltest
+	st := new(state)
+
+	ctx, stop := st.watchSignals(context.Background())
+
+	st.signals <- syscall.SIGTERM
+
+	require.Eventually(t, func() bool { return errors.Is(ctx.Err(), context.Canceled) }, time.Second, 10*time.Millisecond)
+
+	stop()
+	st.stopSignals()
+
+	require.Nil(t, st.signals)
+
+	// after stopping, a signal does not cancel the context
+	ctx, stop = st.watchSignals(context.Background())
+	stop()
+
+	st.signals <- syscall.SIGTERM
+
+	require.NoError(t, ctx.Err())
+
+	// stopping the signals releases the context
+	st.stopSignals()
+
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+	require.Nil(t, st.stopWatch)
+}
+
+func Test_forwardSignal(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, forwardSignal(syscall.SIGTERM, os.Getpid()))
+	require.True(t, forwardSignal(syscall.SIGHUP, os.Getpid()))
+}
@@ -0,0 +1,116 @@
+//go:build linux
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// openTerminal opens a pseudo terminal, returning its master and slave sides.
+func openTerminal(t *testing.T) (*os.File, *os.File) {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0) //nolint:forbidigo
+	if err != nil {
+		t.Skip("pseudo terminals are not available:", err)
+	}
+
+	t.Cleanup(func() { _ = master.Close() })
+
+	require.NoError(t, unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0))
+
+	n, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	require.NoError(t, err)
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0) //nolint:forbidigo
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = slave.Close() })
+
+	return master, slave
+}
+
+func Test_forwardSignal_foreground(t *testing.T) { //nolint:paralleltest
+	master, slave := openTerminal(t)
+
+	// k6 runs in the foreground process group of the terminal of the launcher
+	st := &state{cmd: exec.Command("sh", "-c", "trap '' INT; sleep 1")}
+	st.cmd.Stdin, st.cmd.Stdout, st.cmd.Stderr = slave, slave, slave
+	st.cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	require.NoError(t, st.cmd.Start())
+
+	stdin := os.Stdin //nolint:forbidigo
+	os.Stdin = master //nolint:forbidigo
+
+	t.Cleanup(func() { os.Stdin = stdin }) //nolint:forbidigo
+
+	for _, sig := range shutdownSignals {
+		require.False(t, forwardSignal(sig, st.cmd.Process.Pid), sig.String())
+		require.True(t, forwardSignal(sig, os.Getpid()), sig.String())
+	}
+
+	// the interrupt already delivered by the terminal does not start the grace period
+	st.gracePeriod = 100 * time.Millisecond
+	st.signals = make(chan os.Signal, 1)
+	st.signals <- os.Interrupt
+
+	require.NoError(t, st.wait())
+}
+
+func Test_wait_processGroup(t *testing.T) { //nolint:paralleltest
+	master, slave := openTerminal(t)
+
+	dir := t.TempDir()
+	ready, received := filepath.Join(dir, "ready"), filepath.Join(dir, "received")
+
+	// k6 records the terminate signals received, running in the foreground process group of the terminal
+	script := fmt.Sprintf(
+		"trap 'echo TERM >> %s' TERM; touch %s; i=0; while [ $i -lt 10 ]; do sleep 0.1; i=$((i+1)); done",
+		received, ready,
+	)
+
+	st := &state{cmd: exec.Command("sh", "-c", script), gracePeriod: 10 * time.Second}
+	st.cmd.Stdin, st.cmd.Stdout, st.cmd.Stderr = slave, slave, slave
+	st.cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	require.NoError(t, st.cmd.Start())
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(ready) //nolint:forbidigo
+
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stdin := os.Stdin //nolint:forbidigo
+	os.Stdin = master //nolint:forbidigo
+
+	t.Cleanup(func() { os.Stdin = stdin }) //nolint:forbidigo
+
+	// the terminate signal sent to the process group is received by both the launcher and k6
+	require.NoError(t, unix.Kill(-st.cmd.Process.Pid, unix.SIGTERM))
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(received) //nolint:forbidigo
+
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	st.signals = make(chan os.Signal, 1)
+	st.signals <- syscall.SIGTERM
+
+	require.NoError(t, st.wait())
+
+	data, err := os.ReadFile(received) //nolint:forbidigo
+	require.NoError(t, err)
+	require.Equal(t, "TERM\n", string(data), "the signal is not forwarded again")
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package cmd
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// forwardSignal returns false if the signal was already delivered to k6 by the console:
+// pressing Ctrl-C (or closing the console) sends the event to all the processes attached to the console.
+// A second signal would make k6 abort instead of stopping gracefully.
+//
+//nolint:forbidigo
+func forwardSignal(_ os.Signal, _ int) bool {
+	for _, file := range []*os.File{os.Stdin, os.Stdout, os.Stderr} {
+		if term.IsTerminal(int(file.Fd())) {
+			return false
+		}
+	}
+
+	return true
+}
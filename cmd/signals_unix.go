@@ -0,0 +1,31 @@
+//go:build unix
+
+package cmd
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// forwardSignal returns false if the signal was already delivered to k6 with the foreground process group:
+// the terminal sends the interrupt (Ctrl-C) and the hangup signals to all the processes of the foreground
+// process group, and so does a supervisor (or kill) signaling the process group of the launcher.
+// A second signal would make k6 abort instead of stopping gracefully.
+// The signals are forwarded to k6 running outside of the foreground process group (e.g. in the background).
+//
+//nolint:forbidigo
+func forwardSignal(_ os.Signal, pid int) bool {
+	pgid, err := unix.Getpgid(pid)
+	if err != nil {
+		return true
+	}
+
+	for _, file := range []*os.File{os.Stdin, os.Stdout, os.Stderr} {
+		if foreground, err := unix.IoctlGetInt(int(file.Fd()), unix.TIOCGPGRP); err == nil {
+			return foreground != pgid
+		}
+	}
+
+	return true
+}
@@ -2,30 +2,60 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/grafana/k6exec"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 const (
 	defaultBuildServiceURL = "https://ingest.k6.io/builder/api/v1"
 )
 
+var errInvalidHeader = errors.New("invalid header")
+
 type state struct {
 	k6exec.Options
-	buildServiceURL string
-	verbose         bool
-	quiet           bool
-	nocolor         bool
-	version         bool
-	usage           bool
-	levelVar        *slog.LevelVar
-	cmd             *exec.Cmd
-	cleanup         func() error
-	configFile      string
+	buildServiceURL  string
+	buildServices    string
+	buildServiceAuth string
+	credentialHelper string
+	downloadHeaders  []string
+	signals          chan os.Signal
+	stopWatch        context.CancelFunc
+	gracePeriod      time.Duration
+	replaceProcess   bool
+	trustedKeys      []string
+	verbose          bool
+	quiet            bool
+	nocolor          bool
+	version          bool
+	usage            bool
+	json             bool
+	deps             string
+	output           string
+	force            bool
+	link             bool
+	metadata         bool
+	offline          bool
+	cacheMaxSize     string
+	lockfile         string
+	updateLockfile   bool
+	frozenLockfile   bool
+	mergePolicy      string
+	levelVar         *slog.LevelVar
+	cmd              *exec.Cmd
+	cleanup          func() error
+	configFile       string
 }
 
 func newState(levelVar *slog.LevelVar) *state {
@@ -51,29 +81,73 @@ func (s *state) persistentPreRunE(cmd *cobra.Command, _ []string) error {
 
 	s.Options.BuildServiceURL = buildServiceURL
 
-	// get authorization token for the build service
-	auth := os.Getenv("K6_CLOUD_TOKEN") //nolint:forbidigo
-
-	if len(auth) == 0 {
-		// allow overriding the config file for testing
-		configFile := s.configFile
-		if configFile == "" {
-			// check if the command has a 'config' flag and get the value
-			configFile, err = getFlagValue(cmd, "--config", "-c")
-			if err != nil {
-				return err
-			}
-		}
+	// get authorization token for the build service from the first credential source supplying it,
+	// only if the build service is used
+	s.Options.BuildServiceCredential = s.buildServiceCredential(cmd)
+
+	if s.Options.TrustedKeys, err = parsePublicKeys(s.trustedKeys); err != nil {
+		return fmt.Errorf("invalid trusted key: %w", err)
+	}
+
+	// get the ordered list of build services, if any: first provided from flag, then from environment variable
+	buildServices := s.buildServices
+	if len(buildServices) == 0 {
+		buildServices = os.Getenv("K6EXEC_BUILD_SERVICES") //nolint:forbidigo
+	}
 
-		config, err := loadConfig(configFile)
-		if err != nil {
+	if len(buildServices) > 0 {
+		if s.Options.BuildServices, err = loadBuildServices(buildServices); err != nil {
 			return err
 		}
+	}
+
+	// offline mode: first provided from flag, then from environment variable
+	s.Options.Offline = s.offline
+
+	if value, found := os.LookupEnv("K6EXEC_OFFLINE"); found && !cmd.Flags().Changed("offline") { //nolint:forbidigo
+		if s.Options.Offline, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid K6EXEC_OFFLINE value: %w", err)
+		}
+	}
+
+	// get authorization header for fetching remote scripts
+	s.Options.RemoteAuth = os.Getenv("K6EXEC_REMOTE_AUTH") //nolint:forbidigo
 
-		auth = config.Collectors.Cloud.Token
+	s.setNetworkConfig(cmd)
+
+	if err := s.setDownloadConfig(cmd); err != nil {
+		return err
 	}
 
-	s.Options.BuildServiceToken = auth
+	if err := s.setCacheLimits(cmd); err != nil {
+		return err
+	}
+
+	if err := s.setLockfileMode(); err != nil {
+		return err
+	}
+
+	// replacing the launcher process: first provided from flag, then from environment variable, then default
+	if !cmd.Flags().Changed("exec") {
+		s.replaceProcess = runtime.GOOS == "linux"
+
+		if value, found := os.LookupEnv("K6EXEC_EXEC"); found { //nolint:forbidigo
+			if s.replaceProcess, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("invalid K6EXEC_EXEC value: %w", err)
+			}
+		}
+	}
+
+	gracePeriod := os.Getenv("K6EXEC_GRACE_PERIOD") //nolint:forbidigo
+	if len(gracePeriod) > 0 && !cmd.Flags().Changed("grace-period") {
+		if s.gracePeriod, err = time.ParseDuration(gracePeriod); err != nil {
+			return fmt.Errorf("invalid K6EXEC_GRACE_PERIOD value: %w", err)
+		}
+	}
+
+	if s.Options.MergePolicy, err = k6exec.ParseMergePolicy(s.mergePolicy); err != nil {
+		return err
+	}
 
 	if s.verbose && s.levelVar != nil {
 		s.levelVar.Set(slog.LevelDebug)
@@ -82,6 +156,111 @@ func (s *state) persistentPreRunE(cmd *cobra.Command, _ []string) error {
 	return nil
 }
 
+// setCacheLimits sets the cache limits and the lock timeout: first provided from flag, then from environment variable.
+func (s *state) setCacheLimits(cmd *cobra.Command) error {
+	var err error
+
+	maxSize := s.cacheMaxSize
+	if len(maxSize) == 0 {
+		maxSize = os.Getenv("K6EXEC_CACHE_MAX_SIZE") //nolint:forbidigo
+	}
+
+	if len(maxSize) > 0 {
+		if s.Options.CacheMaxSize, err = parseSize(maxSize); err != nil {
+			return fmt.Errorf("invalid cache max size: %w", err)
+		}
+	}
+
+	maxAge := os.Getenv("K6EXEC_CACHE_MAX_AGE") //nolint:forbidigo
+	if len(maxAge) > 0 && !cmd.Flags().Changed("cache-max-age") {
+		if s.Options.CacheMaxAge, err = time.ParseDuration(maxAge); err != nil {
+			return fmt.Errorf("invalid K6EXEC_CACHE_MAX_AGE value: %w", err)
+		}
+	}
+
+	lockTimeout := os.Getenv("K6EXEC_LOCK_TIMEOUT") //nolint:forbidigo
+	if len(lockTimeout) > 0 && !cmd.Flags().Changed("lock-timeout") {
+		if s.Options.LockTimeout, err = time.ParseDuration(lockTimeout); err != nil {
+			return fmt.Errorf("invalid K6EXEC_LOCK_TIMEOUT value: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// setNetworkConfig sets the proxy and the TLS certificates: first provided from flag, then from environment variable.
+func (s *state) setNetworkConfig(cmd *cobra.Command) {
+	settings := []struct {
+		flag  string
+		env   string
+		value *string
+	}{
+		{flag: "proxy-url", env: "K6EXEC_PROXY_URL", value: &s.Options.ProxyURL},
+		{flag: "ca-cert", env: "K6EXEC_CA_CERT", value: &s.Options.CACertFile},
+		{flag: "client-cert", env: "K6EXEC_CLIENT_CERT", value: &s.Options.ClientCertFile},
+		{flag: "client-key", env: "K6EXEC_CLIENT_KEY", value: &s.Options.ClientKeyFile},
+	}
+
+	for _, setting := range settings {
+		if value := os.Getenv(setting.env); len(value) > 0 && !cmd.Flags().Changed(setting.flag) { //nolint:forbidigo
+			*setting.value = value
+		}
+	}
+}
+
+// setDownloadConfig sets the credentials used to download the k6 executable:
+// the authorization is first provided from flag, then from environment variable.
+func (s *state) setDownloadConfig(cmd *cobra.Command) error {
+	if value := os.Getenv("K6_DOWNLOAD_AUTH"); len(value) > 0 && !cmd.Flags().Changed("download-auth") { //nolint:forbidigo
+		s.Options.DownloadAuth = value
+	}
+
+	if len(s.downloadHeaders) == 0 {
+		return nil
+	}
+
+	s.Options.DownloadHeaders = make(map[string]string, len(s.downloadHeaders))
+
+	for _, header := range s.downloadHeaders {
+		name, value, found := strings.Cut(header, ":")
+		if !found || len(strings.TrimSpace(name)) == 0 {
+			return fmt.Errorf("%w: %q, expected name: value", errInvalidHeader, header)
+		}
+
+		s.Options.DownloadHeaders[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	return nil
+}
+
+func (s *state) setLockfileMode() error {
+	if s.updateLockfile && s.frozenLockfile {
+		return fmt.Errorf("%w: --update-lockfile and --frozen-lockfile cannot be used together", k6exec.ErrLockfile)
+	}
+
+	s.Options.Lockfile = s.lockfile
+
+	switch {
+	case s.updateLockfile:
+		s.Options.LockfileMode = k6exec.LockfileUpdate
+	case s.frozenLockfile:
+		s.Options.LockfileMode = k6exec.LockfileFrozen
+	}
+
+	return nil
+}
+
+// setProgress enables rendering the provisioning progress to the standard error,
+// unless it is not a terminal or --quiet is used. Colors are disabled by --no-color or NO_COLOR.
+func (s *state) setProgress(fd int) {
+	if s.quiet || !term.IsTerminal(fd) {
+		return
+	}
+
+	s.Options.Progress = os.Stderr                                          //nolint:forbidigo
+	s.Options.ProgressColor = !s.nocolor && os.Getenv("NO_COLOR") != "true" //nolint:forbidigo
+}
+
 func (s *state) preRunE(sub *cobra.Command, args []string) error {
 	cmdargs := make([]string, 0, len(args))
 
@@ -116,14 +295,32 @@ func (s *state) preRunE(sub *cobra.Command, args []string) error {
 		ctx = context.Background()
 	}
 
+	s.setProgress(int(os.Stderr.Fd())) //nolint:forbidigo
+
+	// a shutdown signal cancels provisioning, once k6 is started the signals are forwarded to it
+	ctx, stopWatching := s.watchSignals(ctx)
+
 	cmd, cleanup, err := k6exec.Command(ctx, cmdargs, &s.Options)
+
+	stopWatching()
+
+	if err == nil && ctx.Err() != nil {
+		err = errors.Join(ctx.Err(), cleanup())
+	}
+
 	if err != nil {
+		s.stopSignals()
+
 		return err
 	}
 
 	cmd.Stderr = os.Stderr //nolint:forbidigo
 	cmd.Stdout = os.Stdout //nolint:forbidigo
-	cmd.Stdin = os.Stdin   //nolint:forbidigo
+
+	// the standard input may have been already consumed to analyze a script piped to k6
+	if cmd.Stdin == nil {
+		cmd.Stdin = os.Stdin //nolint:forbidigo
+	}
 
 	s.cmd = cmd
 	s.cleanup = cleanup
@@ -142,12 +339,46 @@ func (s *state) runE(_ *cobra.Command, _ []string) error {
 		}
 	}()
 
+	defer s.stopSignals()
+
 	slog.Debug("running", "k6 binary", s.cmd.Path, "args", s.cmd.Args[1:])
-	err = s.cmd.Run()
+
+	if s.replaceProcess {
+		if err := s.replace(); err != nil {
+			slog.Debug("launcher process not replaced, running k6 as a child process", "error", err)
+		}
+	}
+
+	if err = s.cmd.Start(); err != nil {
+		return err
+	}
+
+	err = s.wait()
 
 	return err
 }
 
+// replace replaces the launcher process with k6, if k6 uses the same standard streams as the launcher.
+// As the launcher process is replaced, the cleanup is run before. It returns only if k6 is not started,
+// with an error if the replacement failed.
+func (s *state) replace() error {
+	//nolint:forbidigo
+	if s.cmd.Stdin != os.Stdin || s.cmd.Stdout != os.Stdout || s.cmd.Stderr != os.Stderr {
+		// e.g. the script piped to k6 was already read from the standard input to be analyzed
+		return nil
+	}
+
+	if err := s.cleanup(); err != nil {
+		slog.Warn("cleanup failed", "error", err)
+	}
+
+	// the cleanup is not run again if k6 is run as a child process
+	s.cleanup = func() error { return nil }
+
+	// the signal handlers are reset by replacing the process
+	return execProcess(s.cmd)
+}
+
 func (s *state) helpFunc(cmd *cobra.Command, args []string) {
 	err := s.preRunE(cmd, append(args, "-h"))
 	if err != nil {
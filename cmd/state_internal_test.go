@@ -17,6 +17,8 @@ import (
 func Test_interal_state(t *testing.T) {
 	t.Setenv("K6_BUILD_SERVICE_URL", "")
 	t.Setenv("K6_CLOUD_TOKEN", "")
+	t.Setenv("K6_BUILD_SERVICE_AUTH", "")
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), "netrc"))
 
 	env, err := testutils.NewTestEnv(testutils.TestEnvConfig{
 		WorkDir: t.TempDir(),
@@ -63,7 +65,10 @@ func Test_interal_state(t *testing.T) {
 		}
 
 		require.NoError(t, st.persistentPreRunE(&cobra.Command{}, nil))
-		require.Equal(t, "token", st.Options.BuildServiceToken)
+
+		token, err := st.Options.BuildServiceCredential(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "token", token)
 
 		st = &state{
 			levelVar:   new(slog.LevelVar),
@@ -71,7 +76,10 @@ func Test_interal_state(t *testing.T) {
 		}
 
 		require.NoError(t, st.persistentPreRunE(&cobra.Command{}, nil))
-		require.Empty(t, st.Options.BuildServiceToken)
+
+		token, err = st.Options.BuildServiceCredential(context.Background())
+		require.NoError(t, err)
+		require.Empty(t, token)
 
 		// test config override from flag
 		cmd := &cobra.Command{Use: "test"}
@@ -79,7 +87,10 @@ func Test_interal_state(t *testing.T) {
 		st = &state{
 			levelVar: new(slog.LevelVar),
 		}
-		require.Error(t, st.persistentPreRunE(cmd, nil))
+		require.NoError(t, st.persistentPreRunE(cmd, nil))
+
+		_, err = st.Options.BuildServiceCredential(context.Background())
+		require.Error(t, err)
 	})
 
 	t.Run("Test_preRunE", func(t *testing.T) { //nolint:paralleltest
@@ -156,6 +167,26 @@ func Test_interal_state(t *testing.T) {
 	})
 }
 
+func Test_state_setProgress(t *testing.T) {
+	t.Parallel()
+
+	r, w, err := os.Pipe() //nolint:forbidigo
+	require.NoError(t, err)
+
+	defer r.Close() //nolint:errcheck
+	defer w.Close() //nolint:errcheck
+
+	st := &state{}
+
+	st.setProgress(int(w.Fd()))
+	require.Nil(t, st.Progress)
+
+	st.quiet = true
+
+	st.setProgress(int(os.Stdin.Fd())) //nolint:forbidigo
+	require.Nil(t, st.Progress)
+}
+
 func exists(t *testing.T, filename string) bool {
 	t.Helper()
 
@@ -184,3 +215,27 @@ func captureStderr(t *testing.T, fn func()) string {
 
 	return string(out)
 }
+
+func Test_state_setDownloadConfig(t *testing.T) {
+	t.Setenv("K6_DOWNLOAD_AUTH", "env-auth")
+
+	cmd := New(new(slog.LevelVar))
+
+	st := &state{downloadHeaders: []string{"X-Api-Key: secret", "X-Empty:"}}
+
+	require.NoError(t, st.setDownloadConfig(cmd))
+	require.Equal(t, "env-auth", st.DownloadAuth)
+	require.Equal(t, map[string]string{"X-Api-Key": "secret", "X-Empty": ""}, st.DownloadHeaders)
+
+	require.NoError(t, cmd.PersistentFlags().Set("download-auth", "flag-auth"))
+
+	st = &state{Options: k6exec.Options{DownloadAuth: "flag-auth"}}
+
+	require.NoError(t, st.setDownloadConfig(cmd))
+	require.Equal(t, "flag-auth", st.DownloadAuth)
+	require.Nil(t, st.DownloadHeaders)
+
+	st = &state{downloadHeaders: []string{"invalid"}}
+
+	require.ErrorIs(t, st.setDownloadConfig(cmd), errInvalidHeader)
+}
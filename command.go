@@ -1,35 +1,118 @@
 package k6exec
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"log/slog"
 	"os/exec"
+
+	"github.com/grafana/k6deps"
 )
 
 // Command returns the exec.Cmd struct to execute k6 with the given arguments.
 // If the given subcommand has a script argument, it analyzes the dependencies
 // in the script and provisions a k6 executable based on them.
 // In Options, you can also specify environment variable and manifest file as dependency sources.
-// The second return value is a cleanup function that is used to delete this temporary directory.
-// TODO: as the cache is now handled by the k6provider library, consider removing the cleanup function
+// If the script argument is "-", the script is read from Options.Stdin (or the standard input) and
+// the content read is replayed to the standard input of the returned command.
+// The second return value is a cleanup function to be called after the command is run: it removes
+// the least recently used cached k6 executables exceeding Options.CacheMaxAge or Options.CacheMaxSize.
+// If Options.Platform is not the current platform, ErrPlatform is returned, use Provision instead.
 func Command(ctx context.Context, args []string, opts *Options) (*exec.Cmd, func() error, error) {
-	deps, err := analyze(args, opts)
+	if platform := opts.platform(); platform != hostPlatform() {
+		return nil, nil, fmt.Errorf("%w: the k6 executable for %s cannot be run on %s", ErrPlatform, platform, hostPlatform())
+	}
+
+	analysis, err := Analyze(ctx, args, opts)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	slog.Info("fetching k6 binary")
-
-	exe, err := provision(ctx, deps, opts)
+	binary, err := provisionAnalysis(ctx, analysis, opts)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	exe := binary.Path
+
 	// FIXME: can we leak sensitive information in arguments here? (pablochacin)
 	slog.Debug("running k6", "path", exe, "args", args)
 
 	cmd := exec.CommandContext(ctx, exe, args...) //nolint:gosec
 
-	// TODO: once k6provider implements the cleanup of binary return the proper cleanup function (pablochacin)
-	return cmd, func() error { return nil }, nil
+	if analysis.stdin != nil {
+		cmd.Stdin = bytes.NewReader(analysis.stdin)
+	}
+
+	cleanup := func() error {
+		_, err := pruneCache(opts, binary.Path)
+
+		return err
+	}
+
+	return cmd, cleanup, nil
+}
+
+// Provision provisions a k6 executable for the given k6 command line the same way Command does,
+// without running k6. It can be used to provision k6 executables ahead of time (e.g. in container images).
+// The checksum of the returned k6 executable is always set.
+func Provision(ctx context.Context, args []string, opts *Options) (*Binary, error) {
+	analysis, err := Analyze(ctx, args, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	binary, err := provisionAnalysis(ctx, analysis, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return binary, binary.setChecksum()
+}
+
+// ProvisionDependencies provisions a k6 executable satisfying the given dependencies, without running k6.
+// The checksum of the returned k6 executable is always set.
+func ProvisionDependencies(ctx context.Context, deps k6deps.Dependencies, opts *Options) (*Binary, error) {
+	slog.Info("fetching k6 binary")
+
+	binary, err := provision(ctx, deps, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return binary, binary.setChecksum()
+}
+
+// provisionAnalysis provisions the k6 executable for the analyzed dependencies, pinned by the lockfile.
+func provisionAnalysis(ctx context.Context, analysis *Analysis, opts *Options) (*Binary, error) {
+	lock, err := loadLockfile(analysis, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	deps, err := lock.pin(analysis.Dependencies)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("fetching k6 binary")
+
+	binary, err := provision(ctx, deps, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// the checksum of the cached k6 executables not recorded in the index (e.g. in offline mode) is not known
+	if lock != nil {
+		if err := binary.setChecksum(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := lock.check(binary); err != nil {
+		return nil, err
+	}
+
+	return binary, nil
 }
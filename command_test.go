@@ -2,13 +2,16 @@ package k6exec_test
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
 	"github.com/grafana/k6build/pkg/testutils"
 	"github.com/grafana/k6deps"
 	"github.com/grafana/k6exec"
-	"github.com/grafana/k6provider"
+	"github.com/grafana/k6exec/internal/k6exectest"
 
 	"github.com/stretchr/testify/require"
 )
@@ -61,5 +64,92 @@ func TestCommand_errors(t *testing.T) {
 
 	_, _, err = k6exec.Command(context.TODO(), nil, opts)
 	require.Error(t, err)
-	require.ErrorIs(t, err, k6provider.ErrInvalidParameters)
+	require.ErrorIs(t, err, k6exec.ErrInvalidDependencies)
+}
+
+func TestCommand_provisioner(t *testing.T) {
+	t.Parallel()
+
+	exe := filepath.Join(t.TempDir(), "k6")
+	provisioner := &k6exectest.Provisioner[*k6exec.Binary]{Binary: &k6exec.Binary{Path: exe}}
+
+	opts := &k6exec.Options{
+		Env:         k6deps.Source{Ignore: true},
+		Manifest:    k6deps.Source{Ignore: true},
+		Provisioner: provisioner,
+	}
+
+	cmd, cleanup, err := k6exec.Command(context.TODO(), []string{"run", "examples/combined.js"}, opts)
+	require.NoError(t, err)
+	require.NoError(t, cleanup())
+
+	require.Equal(t, exe, cmd.Path)
+	require.Equal(t, []string{exe, "run", "examples/combined.js"}, cmd.Args)
+	require.Equal(t, "k6>0.54;k6/x/faker>0.4.0;k6/x/sql>=1.0.1;k6/x/sql/driver/ramsql*", provisioner.Deps().String())
+}
+
+func TestProvision(t *testing.T) {
+	t.Parallel()
+
+	exe := filepath.Join(t.TempDir(), "k6")
+
+	require.NoError(t, os.WriteFile(exe, []byte("k6"), 0o600)) //nolint:forbidigo
+
+	opts := &k6exec.Options{
+		Env:      k6deps.Source{Ignore: true},
+		Manifest: k6deps.Source{Ignore: true},
+	}
+
+	provisioner := &k6exectest.Provisioner[*k6exec.Binary]{Binary: &k6exec.Binary{Path: exe}}
+	opts.Provisioner = provisioner
+
+	binary, err := k6exec.Provision(context.TODO(), []string{"run", "examples/combined.js"}, opts)
+	require.NoError(t, err)
+	require.Equal(t, exe, binary.Path)
+	require.Equal(t, k6exectest.K6Checksum, binary.Checksum)
+	require.Equal(t, "k6>0.54;k6/x/faker>0.4.0;k6/x/sql>=1.0.1;k6/x/sql/driver/ramsql*", provisioner.Deps().String())
+
+	var deps k6deps.Dependencies
+
+	require.NoError(t, deps.UnmarshalText([]byte("k6/x/faker*")))
+
+	provisioner = &k6exectest.Provisioner[*k6exec.Binary]{Binary: &k6exec.Binary{Path: exe, Checksum: "known"}}
+	opts.Provisioner = provisioner
+
+	binary, err = k6exec.ProvisionDependencies(context.TODO(), deps, opts)
+	require.NoError(t, err)
+	require.Equal(t, "known", binary.Checksum)
+	require.Equal(t, "k6/x/faker*", provisioner.Deps().String())
+}
+
+func TestCommand_platform(t *testing.T) {
+	t.Parallel()
+
+	exe := filepath.Join(t.TempDir(), "k6")
+
+	require.NoError(t, os.WriteFile(exe, []byte("k6"), 0o600)) //nolint:forbidigo
+
+	platform := "linux/arm64"
+	if runtime.GOOS+"/"+runtime.GOARCH == platform {
+		platform = "linux/amd64"
+	}
+
+	opts := &k6exec.Options{
+		Env:         k6deps.Source{Ignore: true},
+		Manifest:    k6deps.Source{Ignore: true},
+		Provisioner: &k6exectest.Provisioner[*k6exec.Binary]{Binary: &k6exec.Binary{Path: exe}},
+		Platform:    platform,
+	}
+
+	_, _, err := k6exec.Command(context.TODO(), []string{"run", "examples/combined.js"}, opts)
+	require.ErrorIs(t, err, k6exec.ErrPlatform)
+
+	binary, err := k6exec.Provision(context.TODO(), []string{"run", "examples/combined.js"}, opts)
+	require.NoError(t, err)
+	require.Equal(t, exe, binary.Path)
+
+	opts.Platform = "linux"
+
+	_, err = k6exec.Provision(context.TODO(), []string{"run", "examples/combined.js"}, opts)
+	require.ErrorIs(t, err, k6exec.ErrPlatform)
 }
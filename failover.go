@@ -0,0 +1,196 @@
+package k6exec
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/grafana/k6deps"
+)
+
+const (
+	defaultFailoverWindow = 5 * time.Minute
+
+	// serviceHealthName is the name of the file in the cache directory
+	// that records the unavailable build services.
+	serviceHealthName = "build-services.json"
+)
+
+// BuildService contains the properties of a k6 build service.
+type BuildService struct {
+	// URL contains the URL of the build service.
+	URL string `json:"url"`
+	// Token contains the token to be used to authenticate with the build service.
+	Token string `json:"token,omitempty"`
+	// TrustedKeys contains the public keys trusted to sign the k6 executables provided by the build service.
+	// If not empty, a k6 executable without a valid signature of a trusted key is refused.
+	TrustedKeys []ed25519.PublicKey `json:"trusted_keys,omitempty"`
+}
+
+// buildServices returns the build services to be used: Options.BuildServices,
+// or the one defined by Options.BuildServiceURL and Options.BuildServiceToken.
+// Options.TrustedKeys are trusted by each of them.
+func buildServices(opts *Options) []BuildService {
+	if len(opts.BuildServices) == 0 {
+		return []BuildService{{URL: opts.BuildServiceURL, Token: opts.BuildServiceToken, TrustedKeys: opts.TrustedKeys}}
+	}
+
+	if len(opts.TrustedKeys) == 0 {
+		return opts.BuildServices
+	}
+
+	services := make([]BuildService, 0, len(opts.BuildServices))
+
+	for _, service := range opts.BuildServices {
+		service.TrustedKeys = append(slices.Clip(service.TrustedKeys), opts.TrustedKeys...)
+		services = append(services, service)
+	}
+
+	return services
+}
+
+// allTrustedKeys returns the keys trusted by any of the build services.
+func allTrustedKeys(opts *Options) []ed25519.PublicKey {
+	var keys []ed25519.PublicKey
+
+	for _, service := range buildServices(opts) {
+		keys = append(keys, service.TrustedKeys...)
+	}
+
+	return keys
+}
+
+// failoverProvisioner tries the build services in sequence, while they are unavailable.
+// Unavailable build services are recorded and tried last within the failover window.
+type failoverProvisioner struct {
+	services     []BuildService
+	provisioners []Provisioner
+	opts         *Options
+}
+
+func (p *failoverProvisioner) Provision(ctx context.Context, deps k6deps.Dependencies) (*Binary, error) {
+	health := loadServiceHealth(p.opts)
+
+	window := p.opts.FailoverWindow
+	if window == 0 {
+		window = defaultFailoverWindow
+	}
+
+	order := make([]int, 0, len(p.services))
+	unavailable := make([]int, 0, len(p.services))
+
+	for idx, service := range p.services {
+		if since, found := health.Unavailable[service.URL]; found && time.Since(since) < window {
+			slog.Debug("build service recently unavailable", "url", service.URL, "since", since)
+
+			unavailable = append(unavailable, idx)
+		} else {
+			order = append(order, idx)
+		}
+	}
+
+	errs := make([]error, 0, len(p.services))
+
+	for _, idx := range append(order, unavailable...) {
+		url := p.services[idx].URL
+
+		binary, err := p.provisioners[idx].Provision(ctx, deps)
+		if err == nil {
+			health.available(url)
+
+			return binary, nil
+		}
+
+		if !errors.Is(err, ErrBuildServiceUnavailable) {
+			return nil, err
+		}
+
+		slog.Debug("build service unavailable, failing over", "url", url, "error", err)
+
+		health.unavailable(url)
+
+		errs = append(errs, err)
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// serviceHealth records the time since the build services are unavailable.
+// It is shared by the processes using the same cache directory.
+type serviceHealth struct {
+	Unavailable map[string]time.Time `json:"unavailable"`
+
+	path string
+	opts *Options
+}
+
+func loadServiceHealth(opts *Options) *serviceHealth {
+	health := &serviceHealth{Unavailable: make(map[string]time.Time)}
+
+	dir, err := cacheDir(opts)
+	if err != nil {
+		return health
+	}
+
+	health.path, health.opts = filepath.Join(dir, serviceHealthName), opts
+
+	if data, err := os.ReadFile(health.path); err == nil { //nolint:forbidigo,gosec
+		if err := json.Unmarshal(data, health); err != nil || health.Unavailable == nil {
+			health.Unavailable = make(map[string]time.Time)
+		}
+	}
+
+	return health
+}
+
+func (health *serviceHealth) unavailable(url string) {
+	now := time.Now()
+
+	health.update(func(unavailable map[string]time.Time) bool {
+		unavailable[url] = now
+
+		return true
+	})
+}
+
+func (health *serviceHealth) available(url string) {
+	health.update(func(unavailable map[string]time.Time) bool {
+		_, found := unavailable[url]
+		delete(unavailable, url)
+
+		return found
+	})
+}
+
+// update applies the change, which returns whether anything changed, to the health and to the recorded one.
+// The recorded health is reloaded and written under a lock, so the changes of concurrent processes are not lost.
+// Failing to record it only affects the failover order.
+func (health *serviceHealth) update(change func(unavailable map[string]time.Time) bool) {
+	if !change(health.Unavailable) || len(health.path) == 0 {
+		return
+	}
+
+	release, err := acquireLock(context.Background(), health.path+".lock", health.opts)
+	if err == nil {
+		defer release()
+
+		recorded := loadServiceHealth(health.opts)
+		change(recorded.Unavailable)
+
+		var data []byte
+
+		if data, err = json.Marshal(recorded); err == nil {
+			err = writeFileAtomic(health.path, data)
+		}
+	}
+
+	if err != nil {
+		slog.Debug("build service health not recorded", "error", err)
+	}
+}
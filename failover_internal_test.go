@@ -0,0 +1,108 @@
+package k6exec
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_failoverProvisioner(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{CacheDir: t.TempDir(), Retries: -1}
+
+	down, downRequests := flakyServer(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	up, upRequests := flakyServer(t)
+	invalid, invalidRequests := flakyServer(t, http.StatusBadRequest)
+
+	failover := func(urls ...string) *failoverProvisioner {
+		p := &failoverProvisioner{opts: opts}
+
+		for _, url := range urls {
+			p.services = append(p.services, BuildService{URL: url})
+			p.provisioners = append(p.provisioners, newRetryProvisioner(&httpProvisioner{url: url}, opts))
+		}
+
+		return p
+	}
+
+	_, err := failover(down, up).Provision(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), downRequests.Load())
+	require.Equal(t, int32(1), upRequests.Load())
+
+	health := loadServiceHealth(opts)
+	require.Contains(t, health.Unavailable, down)
+	require.NotContains(t, health.Unavailable, up)
+
+	// the unavailable build service is tried last within the failover window
+	_, err = failover(down, up).Provision(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), downRequests.Load())
+	require.Equal(t, int32(2), upRequests.Load())
+
+	// but it is tried if no other build service is available
+	_, err = failover(down).Provision(context.Background(), nil)
+	require.ErrorIs(t, err, ErrBuildServiceUnavailable)
+	require.Equal(t, int32(2), downRequests.Load())
+
+	// no failover on errors other than unavailability
+	_, err = failover(invalid, up).Provision(context.Background(), nil)
+	require.Error(t, err)
+	require.Equal(t, int32(1), invalidRequests.Load())
+	require.Equal(t, int32(2), upRequests.Load())
+
+	// the build service is available again after the failover window
+	opts.FailoverWindow = time.Nanosecond
+
+	_, err = failover(down, up).Provision(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), downRequests.Load())
+	require.Equal(t, int32(3), upRequests.Load())
+
+	// recorded as available after a successful provisioning
+	_, err = failover(down, up).Provision(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, int32(4), downRequests.Load())
+	require.Equal(t, int32(3), upRequests.Load())
+	require.NotContains(t, loadServiceHealth(opts).Unavailable, down)
+}
+
+func Test_serviceHealth_concurrent(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{CacheDir: t.TempDir()}
+
+	var wg sync.WaitGroup
+
+	for idx := range 8 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// each goroutine stands for a process, with its own copy of the health
+			health := loadServiceHealth(opts)
+
+			health.unavailable(fmt.Sprintf("https://build%d.example.com", idx))
+		}()
+	}
+
+	wg.Wait()
+
+	health := loadServiceHealth(opts)
+	require.Len(t, health.Unavailable, 8)
+
+	health.available("https://build0.example.com")
+	require.Len(t, loadServiceHealth(opts).Unavailable, 7)
+
+	matches, err := filepath.Glob(filepath.Join(opts.CacheDir, serviceHealthName+".*.tmp"))
+	require.NoError(t, err)
+	require.Empty(t, matches)
+}
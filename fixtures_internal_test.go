@@ -0,0 +1,98 @@
+package k6exec
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/grafana/k6exec/internal/k6exectest"
+)
+
+// buildService is a stand-in of the build service, providing the fake k6 executables
+// of k6 and the k6/x/faker extension. It counts the build requests and the downloads.
+type buildService struct {
+	*httptest.Server
+	builds    atomic.Int32
+	downloads atomic.Int32
+}
+
+// newBuildService starts the build service, using TLS if the TLS configuration is given.
+func newBuildService(t *testing.T, config *tls.Config) *buildService {
+	t.Helper()
+
+	svc := new(buildService)
+	svc.Server = httptest.NewUnstartedServer(http.HandlerFunc(svc.serve))
+
+	if config != nil {
+		svc.TLS = config
+		svc.StartTLS()
+	} else {
+		svc.Start()
+	}
+
+	t.Cleanup(svc.Close)
+
+	return svc
+}
+
+func (svc *buildService) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/store/") {
+		svc.downloads.Add(1)
+
+		_, _ = io.WriteString(w, "k6")
+
+		return
+	}
+
+	if r.Method != http.MethodPost || r.URL.Path != "/"+buildPath {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	svc.builds.Add(1)
+
+	var req buildRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	var resp buildResponse
+
+	versions := map[string]string{k6deps.NameK6: "v0.55.0"}
+
+	for _, dep := range req.Dependencies {
+		if dep.Name != "k6/x/faker" {
+			resp.Error = &buildError{Err: "building artifact", Reason: &buildError{
+				Err: invalidParameters, Reason: &buildError{Err: "unsupported extension " + dep.Name},
+			}}
+
+			break
+		}
+
+		versions[dep.Name] = "v0.4.0"
+	}
+
+	if resp.Error == nil {
+		id := buildID(req.Platform, versions)
+
+		resp.Artifact = artifact{
+			ID:           id,
+			URL:          svc.URL + "/store/" + id + "/k6",
+			Dependencies: versions,
+			Platform:     req.Platform,
+			Checksum:     k6exectest.K6Checksum,
+		}
+	}
+
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -5,14 +5,17 @@ go 1.23
 toolchain go1.23.7
 
 require (
+	github.com/Masterminds/semver/v3 v3.3.1
 	github.com/grafana/clireadme v0.1.0
 	github.com/grafana/k6build v0.5.9
 	github.com/grafana/k6deps v0.2.4
-	github.com/grafana/k6provider v0.1.13
+	github.com/grafana/k6foundry v0.4.5
 	github.com/samber/slog-logrus/v2 v2.5.2
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/cobra v1.9.1
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/mod v0.23.0
+	golang.org/x/sys v0.30.0
 	golang.org/x/term v0.29.0
 )
 
@@ -28,18 +31,14 @@ require (
 )
 
 require (
-	github.com/Masterminds/semver/v3 v3.3.1 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/evanw/esbuild v0.25.0 // indirect
-	github.com/grafana/k6foundry v0.4.5 // indirect
 	github.com/grafana/k6pack v0.2.4 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/samber/lo v1.47.0 // indirect
 	github.com/samber/slog-common v0.18.1 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
-	golang.org/x/mod v0.23.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,49 @@
+// Package k6exectest contains the test fixtures shared by the tests of k6exec and the launcher.
+package k6exectest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/grafana/k6deps"
+)
+
+// K6Checksum is the SHA-256 checksum of the fake k6 executables, containing "k6".
+const K6Checksum = "1d92ad4b6987fa0347cc5d2fb6cf9e47c83f4f6caeb3b5ef6f629730528921c3"
+
+// Provisioner is a fake provisioner returning the binary (or failing with the error),
+// recording the number of calls and the dependencies of the last call.
+// The type of the binary is a type parameter, so it can be used by the internal tests of k6exec too.
+type Provisioner[B any] struct {
+	Binary B
+	Err    error
+
+	calls atomic.Int32
+	mu    sync.Mutex
+	deps  k6deps.Dependencies
+}
+
+// Provision returns the binary (or the error), recording the dependencies.
+func (p *Provisioner[B]) Provision(_ context.Context, deps k6deps.Dependencies) (B, error) {
+	p.calls.Add(1)
+
+	p.mu.Lock()
+	p.deps = deps
+	p.mu.Unlock()
+
+	return p.Binary, p.Err
+}
+
+// Calls returns the number of calls.
+func (p *Provisioner[B]) Calls() int32 {
+	return p.calls.Load()
+}
+
+// Deps returns the dependencies of the last call.
+func (p *Provisioner[B]) Deps() k6deps.Dependencies {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.deps
+}
@@ -0,0 +1,396 @@
+package k6exec
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/grafana/k6deps"
+	"github.com/grafana/k6foundry"
+	gomodule "golang.org/x/mod/module"
+)
+
+// ErrLocalBuild is returned when the k6 executable cannot be built locally.
+var ErrLocalBuild = errors.New("local build error")
+
+// localBuildsDir is the directory in the cache directory containing the locally built k6 executables.
+const localBuildsDir = "builds"
+
+// localProvisioner builds the k6 executable locally, using the Go toolchain (through k6foundry).
+// The Go modules of k6 and the extensions are resolved using Options.LocalModules and the local
+// Go module sources, falling back to the extension catalog.
+type localProvisioner struct {
+	opts     *Options
+	platform string
+	// newFoundry is used to create the foundry, it can be replaced in tests
+	newFoundry func(ctx context.Context, opts k6foundry.NativeFoundryOpts) (k6foundry.Foundry, error)
+}
+
+func newLocalProvisioner(opts *Options, platform string) *localProvisioner {
+	return &localProvisioner{opts: opts, platform: platform, newFoundry: k6foundry.NewNativeFoundry}
+}
+
+func (p *localProvisioner) Provision(ctx context.Context, deps k6deps.Dependencies) (*Binary, error) {
+	catalog, err := p.catalog(ctx, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, mods, err := resolveModules(deps, catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := cacheDir(p.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	exe := filepath.Join(dir, localBuildsDir, buildID(p.platform, versions), executableName(p.platform))
+
+	binary := &Binary{Path: exe, Dependencies: versions, trustedKeys: allTrustedKeys(p.opts)}
+
+	// the k6 executable is built by one process, the others wait for it and reuse it
+	unlock, err := lockExecutable(ctx, exe, p.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	if binary.Checksum, err = checksum(exe); err == nil {
+		slog.Debug("using locally built binary", "path", exe, "dependencies", deps.String())
+
+		binary.Cached = true
+
+		return binary, nil
+	}
+
+	if binary.Checksum, err = p.build(ctx, exe, versions[k6deps.NameK6], mods); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrLocalBuild, err.Error())
+	}
+
+	return binary, nil
+}
+
+// build builds the k6 executable to exe, returning its checksum.
+func (p *localProvisioner) build(
+	ctx context.Context,
+	exe string,
+	k6Version string,
+	mods []k6foundry.Module,
+) (string, error) {
+	defer progressFromContext(ctx).wait("building k6 binary locally")()
+
+	platform, err := k6foundry.ParsePlatform(p.platform)
+	if err != nil {
+		return "", err
+	}
+
+	foundry, err := p.newFoundry(ctx, k6foundry.NativeFoundryOpts{
+		GoOpts: k6foundry.GoOpts{Env: p.goEnv(), CopyGoEnv: true},
+		Logger: slog.Default(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(exe), 0o700); err != nil { //nolint:forbidigo,mnd
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "k6-*.tmp") //nolint:forbidigo
+	if err != nil {
+		return "", err
+	}
+
+	defer os.Remove(tmp.Name()) //nolint:errcheck,forbidigo
+
+	hash := sha256.New()
+
+	slog.Debug("building binary locally", "platform", p.platform, "k6", k6Version, "modules", mods)
+
+	_, err = foundry.Build(ctx, platform, k6Version, mods, nil, nil, io.MultiWriter(tmp, hash))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o700); err != nil { //nolint:forbidigo,mnd
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), exe); err != nil { //nolint:forbidigo
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// goEnv returns the Go environment variables of the local build.
+func (p *localProvisioner) goEnv() map[string]string {
+	env := make(map[string]string)
+
+	if len(p.opts.GoModCache) > 0 {
+		env["GOMODCACHE"] = p.opts.GoModCache
+	}
+
+	if len(p.opts.GoProxy) > 0 {
+		env["GOPROXY"] = p.opts.GoProxy
+
+		// the checksum database cannot be reached when building from a local module proxy or cache
+		if p.opts.GoProxy == "off" || strings.HasPrefix(p.opts.GoProxy, "file://") {
+			env["GOSUMDB"] = "off"
+		}
+	}
+
+	return env
+}
+
+// catalog returns the catalog entries of k6 and the dependencies. The Go module of k6 and the ones defined by
+// Options.LocalModules are known without the extension catalog, and their versions are listed from the local
+// Go module sources. The extension catalog is only loaded for the other dependencies, or if no version of
+// a known Go module is available locally.
+func (p *localProvisioner) catalog(ctx context.Context, deps k6deps.Dependencies) (map[string]catalogEntry, error) {
+	entries := make(map[string]catalogEntry, len(deps)+1)
+	complete := true
+	goproxy, modcache := p.goEnvironment(ctx)
+
+	for _, name := range append(slices.Collect(maps.Keys(deps)), k6deps.NameK6) {
+		module, found := p.opts.LocalModules[name]
+		if !found && name == k6deps.NameK6 {
+			module, found = k6Module, true
+		}
+
+		if !found {
+			complete = false
+
+			continue
+		}
+
+		versions := localVersions(module, goproxy, modcache)
+		if len(versions) == 0 {
+			complete = false
+		}
+
+		entries[name] = catalogEntry{Module: module, Versions: versions}
+	}
+
+	if complete {
+		return entries, nil
+	}
+
+	catalog, err := loadCatalog(ctx, p.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, entry := range catalog {
+		known, found := entries[name]
+
+		switch {
+		case !found:
+			entries[name] = entry
+		case len(known.Versions) == 0 && known.Module == entry.Module:
+			known.Versions = entry.Versions
+			entries[name] = known
+		}
+	}
+
+	return entries, nil
+}
+
+// goEnvironment returns the GOPROXY and the GOMODCACHE used by the local build: the ones set in the options,
+// or the ones of the Go environment. Like k6foundry, the Go environment is resolved by the go command,
+// so the values set by "go env -w" and the defaults are used too.
+func (p *localProvisioner) goEnvironment(ctx context.Context) (string, string) {
+	goproxy, modcache := p.opts.GoProxy, p.opts.GoModCache
+	if len(goproxy) > 0 && len(modcache) > 0 {
+		return goproxy, modcache
+	}
+
+	values := []string{os.Getenv("GOPROXY"), os.Getenv("GOMODCACHE")} //nolint:forbidigo
+
+	// without the go command, the environment variables are used
+	out, err := exec.CommandContext(ctx, "go", "env", "GOPROXY", "GOMODCACHE").Output()
+	if err != nil {
+		slog.Debug("resolving the Go environment failed", "error", err)
+	} else if lines := strings.Split(strings.TrimRight(string(out), "\r\n"), "\n"); len(lines) == len(values) {
+		values = lines
+	}
+
+	if len(goproxy) == 0 {
+		goproxy = strings.TrimSpace(values[0])
+	}
+
+	if len(modcache) == 0 {
+		modcache = strings.TrimSpace(values[1])
+	}
+
+	if len(modcache) == 0 {
+		modcache = filepath.Join(build.Default.GOPATH, "pkg", "mod")
+	}
+
+	return goproxy, modcache
+}
+
+// localVersions returns the versions of the Go module available locally: in the file based module proxies
+// of goproxy and in the download cache of modcache.
+func localVersions(module string, goproxy string, modcache string) []string {
+	escaped, err := gomodule.EscapePath(module)
+	if err != nil {
+		return nil
+	}
+
+	var dirs []string
+
+	for _, proxy := range strings.FieldsFunc(goproxy, func(r rune) bool { return r == ',' || r == '|' }) {
+		if proxyURL, err := url.Parse(proxy); err == nil && proxyURL.Scheme == "file" {
+			dirs = append(dirs, filepath.FromSlash(proxyURL.Path))
+		}
+	}
+
+	dirs = append(dirs, filepath.Join(modcache, "cache", "download"))
+
+	var versions []string
+
+	for _, dir := range dirs {
+		dir = filepath.Join(dir, escaped, "@v")
+
+		if data, err := os.ReadFile(filepath.Join(dir, "list")); err == nil { //nolint:forbidigo
+			versions = append(versions, strings.Fields(string(data))...)
+		}
+
+		// the versions downloaded to the module cache are not necessarily listed
+		entries, _ := os.ReadDir(dir) //nolint:forbidigo
+
+		for _, entry := range entries {
+			if version, found := strings.CutSuffix(entry.Name(), ".mod"); found {
+				if version, err := gomodule.UnescapeVersion(version); err == nil {
+					versions = append(versions, version)
+				}
+			}
+		}
+	}
+
+	return versions
+}
+
+// resolveModules returns the highest versions of k6 and the extensions in the catalog entries
+// satisfying the dependencies, and the Go modules of the extensions.
+func resolveModules(
+	deps k6deps.Dependencies,
+	catalog map[string]catalogEntry,
+) (map[string]string, []k6foundry.Module, error) {
+	if _, found := deps[k6deps.NameK6]; !found {
+		deps = maps.Clone(deps)
+		deps[k6deps.NameK6] = &k6deps.Dependency{Name: k6deps.NameK6}
+	}
+
+	versions := make(map[string]string, len(deps))
+	modules := make(map[string]string, len(deps))
+	mods := make([]k6foundry.Module, 0, len(deps))
+
+	for _, dep := range deps.Sorted() {
+		entry, found := catalog[dep.Name]
+		if !found {
+			return nil, nil, fmt.Errorf("%w: %s not found in the extension catalog", ErrLocalBuild, dep.Name)
+		}
+
+		version, err := resolveVersion(dep, entry.Versions)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		versions[dep.Name] = version
+
+		if dep.Name == k6deps.NameK6 {
+			continue
+		}
+
+		// several extensions (e.g. JavaScript modules and outputs) can be provided by the same Go module
+		if prev, found := modules[entry.Module]; found {
+			if prev != version {
+				return nil, nil, fmt.Errorf("%w: conflicting versions %s and %s of %s",
+					ErrLocalBuild, prev, version, entry.Module)
+			}
+
+			continue
+		}
+
+		modules[entry.Module] = version
+		mods = append(mods, k6foundry.Module{Path: entry.Module, Version: version})
+	}
+
+	return versions, mods, nil
+}
+
+// resolveVersion returns the highest version satisfying the version constraints of the dependency.
+func resolveVersion(dep *k6deps.Dependency, available []string) (string, error) {
+	var found *semver.Version
+
+	for _, version := range available {
+		semversion, err := semver.NewVersion(version)
+		if err != nil {
+			continue
+		}
+
+		if dep.GetConstraints().Check(semversion) && (found == nil || semversion.GreaterThan(found)) {
+			found = semversion
+		}
+	}
+
+	if found == nil {
+		return "", fmt.Errorf("%w: no available version of %s satisfies %s",
+			ErrLocalBuild, dep.Name, dep.GetConstraints())
+	}
+
+	return found.Original(), nil
+}
+
+// buildID returns the identifier of the build of the given versions for the platform.
+func buildID(platform string, versions map[string]string) string {
+	hash := sha256.New()
+
+	_, _ = io.WriteString(hash, platform)
+
+	for _, name := range slices.Sorted(maps.Keys(versions)) {
+		_, _ = fmt.Fprintf(hash, ";%s=%s", name, versions[name])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// checksum returns the SHA-256 checksum of the file.
+func checksum(filename string) (string, error) {
+	file, err := os.Open(filename) //nolint:forbidigo,gosec
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close() //nolint:errcheck
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,209 @@
+package k6exec
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/grafana/k6exec/internal/k6exectest"
+	"github.com/grafana/k6foundry"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeFoundry struct {
+	opts      k6foundry.NativeFoundryOpts
+	k6Version string
+	mods      []k6foundry.Module
+	builds    int
+}
+
+func (f *fakeFoundry) Build(
+	_ context.Context,
+	platform k6foundry.Platform,
+	k6Version string,
+	mods []k6foundry.Module,
+	_ []k6foundry.Module,
+	_ []string,
+	out io.Writer,
+) (*k6foundry.BuildInfo, error) {
+	f.builds++
+	f.k6Version, f.mods = k6Version, mods
+
+	_, err := io.WriteString(out, "k6")
+
+	return &k6foundry.BuildInfo{Platform: platform.OS + "/" + platform.Arch}, err
+}
+
+func Test_localProvisioner(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	catalog := filepath.Join(dir, "catalog.json")
+
+	require.NoError(t, os.WriteFile(catalog, []byte(`{
+  "k6": {"module": "go.k6.io/k6", "versions": ["v0.56.0", "v0.57.0", "v0.58.0"]},
+  "k6/x/faker": {"module": "github.com/grafana/xk6-faker", "versions": ["v0.4.0", "v0.4.1"]},
+  "k6/x/sql": {"module": "github.com/grafana/xk6-sql", "versions": ["v1.0.0"]},
+  "sql": {"module": "github.com/grafana/xk6-sql", "versions": ["v1.0.0"]}
+}`), 0o600)) //nolint:forbidigo
+
+	opts := &Options{
+		CacheDir:   filepath.Join(dir, "cache"),
+		CatalogURL: catalog,
+		GoProxy:    "off",
+		GoModCache: filepath.Join(dir, "gomodcache"),
+	}
+	foundry := new(fakeFoundry)
+
+	provisioner := newLocalProvisioner(opts, "linux/amd64")
+	provisioner.newFoundry = func(_ context.Context, opts k6foundry.NativeFoundryOpts) (k6foundry.Foundry, error) {
+		foundry.opts = opts
+
+		return foundry, nil
+	}
+
+	var deps k6deps.Dependencies
+
+	require.NoError(t, deps.UnmarshalText([]byte("k6<0.58.0;k6/x/faker>0.4.0;k6/x/sql*;sql*")))
+
+	binary, err := provisioner.Provision(context.Background(), deps)
+	require.NoError(t, err)
+
+	require.FileExists(t, binary.Path)
+	require.False(t, binary.Cached)
+	require.Equal(t, k6exectest.K6Checksum, binary.Checksum)
+	require.Equal(t,
+		map[string]string{"k6": "v0.57.0", "k6/x/faker": "v0.4.1", "k6/x/sql": "v1.0.0", "sql": "v1.0.0"},
+		binary.Dependencies,
+	)
+	require.Equal(t, "v0.57.0", foundry.k6Version)
+	require.Equal(t, []k6foundry.Module{
+		{Path: "github.com/grafana/xk6-faker", Version: "v0.4.1"},
+		{Path: "github.com/grafana/xk6-sql", Version: "v1.0.0"},
+	}, foundry.mods)
+	require.Equal(t,
+		map[string]string{"GOPROXY": "off", "GOSUMDB": "off", "GOMODCACHE": opts.GoModCache},
+		foundry.opts.Env,
+	)
+
+	// the binary built is cached and recorded for offline use
+	recording := &recordingProvisioner{provisioner: provisioner, opts: opts, platform: "linux/amd64"}
+
+	cached, err := recording.Provision(context.Background(), deps)
+	require.NoError(t, err)
+	require.True(t, cached.Cached)
+	require.Equal(t, binary.Path, cached.Path)
+	require.Equal(t, binary.Checksum, cached.Checksum)
+	require.Equal(t, 1, foundry.builds)
+
+	index, err := loadBinaryIndex(opts)
+	require.NoError(t, err)
+	require.Len(t, index.Binaries, 1)
+
+	// unresolvable dependencies
+	for _, text := range []string{"k6>0.58.0", "k6/x/sql>1.0.0", "k6/x/unknown*"} {
+		var unresolvable k6deps.Dependencies
+
+		require.NoError(t, unresolvable.UnmarshalText([]byte(text)))
+
+		_, err = provisioner.Provision(context.Background(), unresolvable)
+		require.ErrorIs(t, err, ErrLocalBuild)
+	}
+
+	// with trusted keys, the cached local build must match the recorded checksum
+	key, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	opts.TrustedKeys = []ed25519.PublicKey{key}
+
+	_, err = recording.Provision(context.Background(), deps)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(binary.Path, []byte("tampered"), 0o700)) //nolint:forbidigo
+
+	_, err = recording.Provision(context.Background(), deps)
+	require.ErrorIs(t, err, ErrSignature)
+}
+
+func Test_localProvisioner_localModules(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	write := func(path string, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))     //nolint:forbidigo
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600)) //nolint:forbidigo
+	}
+
+	// versions listed by a file based module proxy, and downloaded to the module cache
+	proxy := filepath.Join(dir, "proxy")
+	modcache := filepath.Join(dir, "gomodcache")
+
+	write(filepath.Join(proxy, "go.k6.io", "k6", "@v", "list"), "v0.56.0\nv0.57.0\nv0.58.0\n")
+	write(filepath.Join(proxy, "github.com", "grafana", "xk6-faker", "@v", "list"), "v0.4.0\nv0.4.1\n")
+	write(filepath.Join(modcache, "cache", "download", "github.com", "grafana", "xk6-faker", "@v", "v0.4.2.mod"), "")
+
+	opts := &Options{
+		CacheDir:     filepath.Join(dir, "cache"),
+		CatalogURL:   filepath.Join(dir, "missing-catalog.json"),
+		GoProxy:      "file://" + filepath.ToSlash(proxy),
+		GoModCache:   modcache,
+		LocalModules: map[string]string{"k6/x/faker": "github.com/grafana/xk6-faker"},
+	}
+	foundry := new(fakeFoundry)
+
+	provisioner := newLocalProvisioner(opts, "linux/amd64")
+	provisioner.newFoundry = func(context.Context, k6foundry.NativeFoundryOpts) (k6foundry.Foundry, error) {
+		return foundry, nil
+	}
+
+	var deps k6deps.Dependencies
+
+	require.NoError(t, deps.UnmarshalText([]byte("k6<0.58.0;k6/x/faker>0.4.0")))
+
+	// the extension catalog is not needed
+	binary, err := provisioner.Provision(context.Background(), deps)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"k6": "v0.57.0", "k6/x/faker": "v0.4.2"}, binary.Dependencies)
+	require.Equal(t, []k6foundry.Module{{Path: "github.com/grafana/xk6-faker", Version: "v0.4.2"}}, foundry.mods)
+
+	// but it is needed for the other extensions
+	require.NoError(t, deps.UnmarshalText([]byte("k6/x/sql*")))
+
+	_, err = provisioner.Provision(context.Background(), deps)
+	require.ErrorIs(t, err, ErrCatalog)
+}
+
+func Test_localProvisioner_goEnvironment(t *testing.T) { //nolint:paralleltest
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("the go command is not available")
+	}
+
+	dir := t.TempDir()
+	goenv := filepath.Join(dir, "go.env")
+
+	// the values set by "go env -w" are stored in the GOENV file, not in the environment variables
+	require.NoError(t, os.WriteFile(goenv, []byte("GOPROXY=file:///proxy\nGOMODCACHE="+dir+"\n"), 0o600)) //nolint:forbidigo
+
+	t.Setenv("GOENV", goenv)
+	t.Setenv("GOPROXY", "")
+	t.Setenv("GOMODCACHE", "")
+
+	provisioner := newLocalProvisioner(&Options{}, "linux/amd64")
+
+	goproxy, modcache := provisioner.goEnvironment(context.Background())
+	require.Equal(t, "file:///proxy", goproxy)
+	require.Equal(t, dir, modcache)
+
+	// the options take precedence
+	provisioner = newLocalProvisioner(&Options{GoProxy: "off", GoModCache: "/modcache"}, "linux/amd64")
+
+	goproxy, modcache = provisioner.goEnvironment(context.Background())
+	require.Equal(t, "off", goproxy)
+	require.Equal(t, "/modcache", modcache)
+}
@@ -0,0 +1,112 @@
+package k6exec
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLockTimeout = 15 * time.Minute
+	lockPoll           = 100 * time.Millisecond
+	locksDir           = "locks"
+)
+
+// ErrLockTimeout is returned when a lock of the cache cannot be acquired within Options.LockTimeout.
+var ErrLockTimeout = errors.New("lock timeout")
+
+// lockExecutable acquires the lock of the k6 executable to be provisioned to path (shared by the processes
+// using the same cache directory), so only one process downloads (or builds) it, and the others reuse it.
+// The lock is keyed on the resolved k6 executable, so it is shared by all the dependencies resolved to it.
+func lockExecutable(ctx context.Context, path string, opts *Options) (func(), error) {
+	dir, err := cacheDir(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	key := sha256.Sum256([]byte(filepath.Clean(path)))
+
+	return acquireLock(ctx, filepath.Join(dir, locksDir, hex.EncodeToString(key[:16])+".lock"), opts)
+}
+
+// acquireLock locks the lock file exclusively, waiting while it is locked by another process.
+// The lock is held by the open lock file, so it is released by the operating system if the process exits
+// (e.g. it is killed). The lock file is never removed, as another process may be waiting for it.
+// The returned function releases the lock.
+func acquireLock(ctx context.Context, path string, opts *Options) (func(), error) {
+	timeout := opts.LockTimeout
+	if timeout == 0 {
+		timeout = defaultLockTimeout
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil { //nolint:forbidigo,mnd
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600) //nolint:forbidigo,mnd,gosec
+	if err != nil {
+		return nil, err
+	}
+
+	if err := waitLock(ctx, file, timeout); err != nil {
+		_ = file.Close()
+
+		return nil, err
+	}
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			_ = unlockFile(file)
+			_ = file.Close()
+		})
+	}, nil
+}
+
+// waitLock locks the file, polling while it is locked by another process.
+func waitLock(ctx context.Context, file *os.File, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	var stopWaiting func()
+
+	defer func() {
+		if stopWaiting != nil {
+			stopWaiting()
+		}
+	}()
+
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Name(), err)
+		}
+
+		if locked {
+			return nil
+		}
+
+		if stopWaiting == nil {
+			slog.Debug("waiting for lock held by another process", "path", file.Name())
+
+			stopWaiting = progressFromContext(ctx).wait("waiting for another process provisioning the k6 binary")
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s: held by another process for more than %s", ErrLockTimeout, file.Name(), timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+}
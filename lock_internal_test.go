@@ -0,0 +1,148 @@
+package k6exec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6deps"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_acquireLock(t *testing.T) {
+	t.Parallel()
+
+	t.Run("wait for release", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "test.lock")
+
+		release, err := acquireLock(context.Background(), path, &Options{})
+		require.NoError(t, err)
+		require.FileExists(t, path)
+
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			release()
+		}()
+
+		start := time.Now()
+
+		again, err := acquireLock(context.Background(), path, &Options{})
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+		again()
+		again()
+
+		// the lock file is kept, as other processes may be waiting for it
+		require.FileExists(t, path)
+	})
+
+	t.Run("release once", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "test.lock")
+
+		release, err := acquireLock(context.Background(), path, &Options{})
+		require.NoError(t, err)
+
+		release()
+
+		other, err := acquireLock(context.Background(), path, &Options{})
+		require.NoError(t, err)
+
+		defer other()
+
+		// releasing again does not release the lock acquired by another holder
+		release()
+
+		_, err = acquireLock(context.Background(), path, &Options{LockTimeout: 300 * time.Millisecond})
+		require.ErrorIs(t, err, ErrLockTimeout)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "test.lock")
+
+		release, err := acquireLock(context.Background(), path, &Options{})
+		require.NoError(t, err)
+
+		defer release()
+
+		_, err = acquireLock(context.Background(), path, &Options{LockTimeout: 300 * time.Millisecond})
+		require.ErrorIs(t, err, ErrLockTimeout)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "test.lock")
+
+		release, err := acquireLock(context.Background(), path, &Options{})
+		require.NoError(t, err)
+
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		_, err = acquireLock(ctx, path, &Options{})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("left behind", func(t *testing.T) {
+		t.Parallel()
+
+		// a lock file left behind (e.g. by a killed process) is not locked
+		path := filepath.Join(t.TempDir(), "test.lock")
+
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+		release, err := acquireLock(context.Background(), path, &Options{LockTimeout: time.Millisecond})
+		require.NoError(t, err)
+
+		release()
+	})
+}
+
+func Test_lockExecutable(t *testing.T) {
+	t.Parallel()
+
+	svc := newBuildService(t, nil)
+
+	opts := &Options{BuildServiceURL: svc.URL, CacheDir: t.TempDir(), BinaryCacheDir: t.TempDir()}
+	provisioner := newBuildServiceProvisioner(opts, hostPlatform())
+
+	var wg sync.WaitGroup
+
+	// the different constraints are resolved to the same k6 executable, which is downloaded once
+	for _, text := range []string{"k6*", "k6>0.50", "k6>0.54", "k6<1.0"} {
+		var deps k6deps.Dependencies
+
+		require.NoError(t, deps.UnmarshalText([]byte(text)))
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			binary, err := provisioner.Provision(context.Background(), deps)
+			require.NoError(t, err)
+			require.FileExists(t, binary.Path)
+		}()
+	}
+
+	wg.Wait()
+
+	require.Equal(t, int32(4), svc.builds.Load())
+	require.Equal(t, int32(1), svc.downloads.Load())
+
+	entries, err := os.ReadDir(filepath.Join(opts.CacheDir, locksDir))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
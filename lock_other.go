@@ -0,0 +1,15 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package k6exec
+
+import "os"
+
+// tryLockFile always succeeds, as file locking is not supported on this platform:
+// the processes sharing the cache directory are not serialized.
+func tryLockFile(*os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(*os.File) error {
+	return nil
+}
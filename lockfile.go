@@ -0,0 +1,204 @@
+package k6exec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/grafana/k6deps"
+)
+
+// LockfileName is the name of the lockfile, which is searched for next to the manifest file.
+const LockfileName = "k6exec.lock"
+
+// ErrLockfile is returned when the lockfile cannot be used or it does not match the provisioned k6 executable.
+var ErrLockfile = errors.New("lockfile error")
+
+// LockfileMode defines how the lockfile is used.
+type LockfileMode string
+
+const (
+	// LockfileAuto uses the lockfile if it exists, but does not write it.
+	// The lockfile is enforced: an error is returned if it does not match the dependencies
+	// or the provisioned k6 executable.
+	LockfileAuto LockfileMode = ""
+	// LockfileUpdate resolves the dependencies regardless of the lockfile and (re)writes the lockfile.
+	LockfileUpdate LockfileMode = "update"
+	// LockfileFrozen requires the lockfile to exist and to match the dependencies,
+	// the provisioned k6 executable and its checksum for the current platform.
+	LockfileFrozen LockfileMode = "frozen"
+	// LockfileIgnore does not use the lockfile at all.
+	LockfileIgnore LockfileMode = "ignore"
+)
+
+// lockfile contains the properties stored in the lockfile.
+type lockfile struct {
+	// Dependencies contains the resolved version of k6 and the extensions.
+	Dependencies map[string]string `json:"dependencies"`
+	// Checksums contains the checksum of the k6 executable, indexed by platform.
+	Checksums map[string]string `json:"checksums"`
+
+	path     string
+	mode     LockfileMode
+	platform string
+}
+
+// loadLockfile loads the lockfile to be used for the analyzed dependencies.
+// It returns nil if the lockfile is not used. The lockfile is used only if a script (or an archive) was analyzed:
+// the k6 commands without a script (e.g. version) use the k6 executable satisfying the other sources.
+func loadLockfile(analysis *Analysis, opts *Options) (*lockfile, error) {
+	if opts.LockfileMode == LockfileIgnore || !analysis.scripted {
+		return nil, nil //nolint:nilnil
+	}
+
+	lock := &lockfile{path: lockfilePath(analysis, opts), mode: opts.LockfileMode, platform: opts.platform()}
+
+	if lock.mode == LockfileUpdate {
+		return lock, nil
+	}
+
+	data, err := os.ReadFile(lock.path) //nolint:forbidigo,gosec
+
+	switch {
+	case errors.Is(err, os.ErrNotExist) && lock.mode == LockfileFrozen: //nolint:forbidigo
+		return nil, fmt.Errorf("%w: %s not found", ErrLockfile, lock.path)
+	case errors.Is(err, os.ErrNotExist): //nolint:forbidigo
+		return nil, nil //nolint:nilnil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrLockfile, lock.path, err.Error())
+	}
+
+	slog.Debug("using lockfile", "path", lock.path, "mode", lock.mode)
+
+	return lock, nil
+}
+
+// lockfilePath returns the path of the lockfile: next to the manifest file, or the script,
+// or in the current directory.
+func lockfilePath(analysis *Analysis, opts *Options) string {
+	if len(opts.Lockfile) > 0 {
+		return opts.Lockfile
+	}
+
+	dir := "."
+
+	switch {
+	case len(analysis.manifest) > 0:
+		dir = filepath.Dir(analysis.manifest)
+	case len(analysis.script) > 0:
+		dir = filepath.Dir(analysis.script)
+	}
+
+	return filepath.Join(dir, LockfileName)
+}
+
+// pin returns the dependencies pinned to the locked versions.
+// An error is returned if the dependencies have drifted from the lockfile.
+func (lock *lockfile) pin(deps k6deps.Dependencies) (k6deps.Dependencies, error) {
+	if lock == nil || lock.mode == LockfileUpdate {
+		return deps, nil
+	}
+
+	for name, dep := range deps {
+		locked, found := lock.Dependencies[name]
+		if !found {
+			return nil, lock.drift("%s is not locked", name)
+		}
+
+		version, err := semver.NewVersion(locked)
+		if err != nil {
+			return nil, lock.drift("invalid version %s of %s", locked, name)
+		}
+
+		if !dep.GetConstraints().Check(version) {
+			return nil, lock.drift("locked version %s of %s does not satisfy %s", locked, name, dep.GetConstraints())
+		}
+	}
+
+	pinned := make(k6deps.Dependencies, len(lock.Dependencies))
+
+	for name, version := range lock.Dependencies {
+		dep, err := k6deps.NewDependency(name, "="+version)
+		if err != nil {
+			return nil, lock.drift("invalid version %s of %s", version, name)
+		}
+
+		pinned[name] = dep
+	}
+
+	slog.Debug("dependencies pinned by lockfile", "deps", pinned.String())
+
+	return pinned, nil
+}
+
+// check verifies the provisioned binary against the lockfile or updates the lockfile,
+// depending on the lockfile mode.
+func (lock *lockfile) check(binary *Binary) error {
+	if lock == nil {
+		return nil
+	}
+
+	platform := lock.platform
+
+	if lock.mode == LockfileUpdate {
+		return lock.update(binary, platform)
+	}
+
+	if !maps.Equal(lock.Dependencies, binary.Dependencies) {
+		return lock.drift("provisioned versions %v differ from the locked ones", binary.Dependencies)
+	}
+
+	checksum, found := lock.Checksums[platform]
+
+	switch {
+	case !found && lock.mode == LockfileFrozen:
+		return lock.drift("no checksum locked for platform %s", platform)
+	case !found:
+		slog.Debug("no checksum locked for platform", "platform", platform)
+	case checksum != binary.Checksum:
+		return lock.drift("checksum %s differs from the locked checksum %s", binary.Checksum, checksum)
+	}
+
+	return nil
+}
+
+func (lock *lockfile) update(binary *Binary, platform string) error {
+	// checksums of other platforms remain valid only if the locked versions are the same
+	if data, err := os.ReadFile(lock.path); err == nil { //nolint:forbidigo,gosec
+		var prev lockfile
+
+		if err := json.Unmarshal(data, &prev); err == nil && maps.Equal(prev.Dependencies, binary.Dependencies) {
+			lock.Checksums = prev.Checksums
+		}
+	}
+
+	if lock.Checksums == nil {
+		lock.Checksums = make(map[string]string, 1)
+	}
+
+	lock.Dependencies = binary.Dependencies
+	lock.Checksums[platform] = binary.Checksum
+
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("writing lockfile", "path", lock.path)
+
+	return os.WriteFile(lock.path, append(data, '\n'), 0o644) //nolint:forbidigo,gosec,mnd
+}
+
+func (lock *lockfile) drift(format string, args ...any) error {
+	return fmt.Errorf("%w: %s: %s (update the lockfile to accept the changes)",
+		ErrLockfile, lock.path, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,186 @@
+package k6exec
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/grafana/k6exec/internal/k6exectest"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_lockfile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, LockfileName)
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+
+	var deps k6deps.Dependencies
+
+	require.NoError(t, deps.UnmarshalText([]byte("k6>0.54;k6/x/faker>0.4.0")))
+
+	binary := &Binary{
+		Path:         "k6",
+		Checksum:     "checksum",
+		Dependencies: map[string]string{"k6": "v0.57.0", "k6/x/faker": "v0.4.1"},
+	}
+
+	analysis := &Analysis{manifest: filepath.Join(dir, "package.json"), scripted: true}
+
+	// no lockfile
+	lock, err := loadLockfile(analysis, &Options{})
+	require.NoError(t, err)
+	require.Nil(t, lock)
+
+	_, err = loadLockfile(analysis, &Options{LockfileMode: LockfileFrozen})
+	require.ErrorIs(t, err, ErrLockfile)
+
+	// write lockfile
+	lock, err = loadLockfile(analysis, &Options{LockfileMode: LockfileUpdate})
+	require.NoError(t, err)
+
+	pinned, err := lock.pin(deps)
+	require.NoError(t, err)
+	require.Equal(t, deps, pinned)
+	require.NoError(t, lock.check(binary))
+	require.FileExists(t, path)
+
+	// enforce lockfile
+	for _, mode := range []LockfileMode{LockfileAuto, LockfileFrozen} {
+		lock, err = loadLockfile(analysis, &Options{LockfileMode: mode})
+		require.NoError(t, err)
+		require.Equal(t, path, lock.path)
+		require.Equal(t, binary.Dependencies, lock.Dependencies)
+		require.Equal(t, map[string]string{platform: "checksum"}, lock.Checksums)
+
+		pinned, err = lock.pin(deps)
+		require.NoError(t, err)
+		require.Equal(t, "k6=v0.57.0;k6/x/faker=v0.4.1", pinned.String())
+		require.NoError(t, lock.check(binary))
+
+		tampered := *binary
+		tampered.Checksum = "tampered"
+		require.ErrorIs(t, lock.check(&tampered), ErrLockfile)
+
+		upgraded := *binary
+		upgraded.Dependencies = map[string]string{"k6": "v0.58.0", "k6/x/faker": "v0.4.1"}
+		require.ErrorIs(t, lock.check(&upgraded), ErrLockfile)
+	}
+
+	// drift
+	var drifted k6deps.Dependencies
+
+	require.NoError(t, drifted.UnmarshalText([]byte("k6>0.54;k6/x/faker>0.5")))
+
+	_, err = lock.pin(drifted)
+	require.ErrorIs(t, err, ErrLockfile)
+
+	require.NoError(t, drifted.UnmarshalText([]byte("k6>0.54;k6/x/sql>0.1")))
+
+	_, err = lock.pin(drifted)
+	require.ErrorIs(t, err, ErrLockfile)
+
+	// explicit lockfile path
+	lock, err = loadLockfile(analysis, &Options{Lockfile: filepath.Join(dir, "other.lock")})
+	require.NoError(t, err)
+	require.Nil(t, lock)
+
+	// ignored lockfile
+	lock, err = loadLockfile(analysis, &Options{LockfileMode: LockfileIgnore})
+	require.NoError(t, err)
+	require.Nil(t, lock)
+
+	require.NoError(t, os.WriteFile(path, []byte("invalid"), 0o600)) //nolint:forbidigo
+
+	_, err = loadLockfile(analysis, &Options{})
+	require.ErrorIs(t, err, ErrLockfile)
+
+	// the lockfile is not used without a script
+	for _, mode := range []LockfileMode{LockfileAuto, LockfileFrozen, LockfileUpdate} {
+		lock, err = loadLockfile(&Analysis{manifest: analysis.manifest}, &Options{LockfileMode: mode})
+		require.NoError(t, err)
+		require.Nil(t, lock)
+	}
+}
+
+func TestProvision_lockfile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, LockfileName)
+
+	lock := `{"dependencies":{"k6":"v0.57.0"},"checksums":{}}`
+
+	require.NoError(t, os.WriteFile(path, []byte(lock), 0o600)) //nolint:forbidigo
+
+	opts := &Options{
+		Env:          k6deps.Source{Ignore: true},
+		Manifest:     k6deps.Source{Ignore: true},
+		Lockfile:     path,
+		LockfileMode: LockfileFrozen,
+		Provisioner: &k6exectest.Provisioner[*Binary]{Binary: &Binary{
+			Path:         "k6",
+			Checksum:     k6exectest.K6Checksum,
+			Dependencies: map[string]string{"k6": "v0.58.0"},
+		}},
+	}
+
+	// the k6 commands without a script are not pinned by the lockfile
+	binary, err := Provision(context.Background(), []string{"version"}, opts)
+	require.NoError(t, err)
+	require.Equal(t, "v0.58.0", binary.Dependencies["k6"])
+
+	_, err = Provision(context.Background(), []string{"run", "examples/combined.js"}, opts)
+	require.ErrorIs(t, err, ErrLockfile)
+
+	data, err := os.ReadFile(path) //nolint:forbidigo
+	require.NoError(t, err)
+	require.Equal(t, lock, string(data))
+}
+
+func Test_provisionAnalysis_lockfile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "k6")
+
+	require.NoError(t, os.WriteFile(exe, []byte("k6"), 0o600)) //nolint:forbidigo
+
+	var deps k6deps.Dependencies
+
+	require.NoError(t, deps.UnmarshalText([]byte("k6>0.54")))
+
+	analysis := &Analysis{Dependencies: deps, manifest: filepath.Join(dir, "package.json"), scripted: true}
+	versions := map[string]string{"k6": "v0.57.0"}
+
+	// the checksum of an executable not recorded in the index (e.g. found in offline mode) is calculated
+	newOptions := func(mode LockfileMode) *Options {
+		return &Options{
+			LockfileMode: mode,
+			Provisioner:  &k6exectest.Provisioner[*Binary]{Binary: &Binary{Path: exe, Dependencies: versions}},
+		}
+	}
+
+	binary, err := provisionAnalysis(context.Background(), analysis, newOptions(LockfileUpdate))
+	require.NoError(t, err)
+	require.Equal(t, k6exectest.K6Checksum, binary.Checksum)
+
+	lock, err := loadLockfile(analysis, &Options{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{hostPlatform(): k6exectest.K6Checksum}, lock.Checksums)
+
+	for _, mode := range []LockfileMode{LockfileAuto, LockfileFrozen} {
+		binary, err = provisionAnalysis(context.Background(), analysis, newOptions(mode))
+		require.NoError(t, err)
+		require.Equal(t, k6exectest.K6Checksum, binary.Checksum)
+	}
+
+	require.NoError(t, os.WriteFile(exe, []byte("tampered"), 0o600)) //nolint:forbidigo
+
+	_, err = provisionAnalysis(context.Background(), analysis, newOptions(LockfileAuto))
+	require.ErrorIs(t, err, ErrLockfile)
+}
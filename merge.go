@@ -0,0 +1,107 @@
+package k6exec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/k6deps"
+)
+
+// ErrMergePolicy is returned when the merge policy is unknown or the constraints cannot be merged with it.
+var ErrMergePolicy = errors.New("merge policy error")
+
+// MergePolicy defines how the version constraints of a dependency found in several sources are merged.
+// The sources are merged in the following order: script, manifest, environment variable.
+type MergePolicy string
+
+const (
+	// MergeStrict requires the version constraints from different sources to be equal,
+	// or only one source to contain version constraints. This is the default policy.
+	MergeStrict MergePolicy = "strict"
+	// MergeOverride lets the version constraints of a later source override the earlier ones:
+	// the environment variable overrides the manifest, and the manifest overrides the script pragmas.
+	MergeOverride MergePolicy = "override"
+	// MergeIntersect combines the version constraints of all sources,
+	// so the version must satisfy the constraints of every source.
+	MergeIntersect MergePolicy = "intersect"
+)
+
+// ParseMergePolicy returns the merge policy with the given name.
+func ParseMergePolicy(name string) (MergePolicy, error) {
+	switch policy := MergePolicy(name); policy {
+	case MergeStrict, MergeOverride, MergeIntersect:
+		return policy, nil
+	case "":
+		return MergeStrict, nil
+	default:
+		return "", fmt.Errorf("%w: unknown policy %q", ErrMergePolicy, name)
+	}
+}
+
+// merge merges the from dependencies into the into dependencies using the policy.
+func (policy MergePolicy) merge(into, from k6deps.Dependencies) error {
+	switch policy {
+	case MergeStrict, "":
+		return into.Merge(from)
+	case MergeOverride:
+		for name, dep := range from {
+			if existing, found := into[name]; found && isAny(dep) {
+				dep = existing
+			}
+
+			into[name] = &k6deps.Dependency{Name: name, Constraints: dep.Constraints}
+		}
+
+		return nil
+	case MergeIntersect:
+		for name, dep := range from {
+			existing, found := into[name]
+
+			switch {
+			case !found || isAny(existing):
+			case isAny(dep):
+				dep = existing
+			default:
+				merged, err := intersect(name, existing, dep)
+				if err != nil {
+					return err
+				}
+
+				dep = merged
+			}
+
+			into[name] = &k6deps.Dependency{Name: name, Constraints: dep.Constraints}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown policy %q", ErrMergePolicy, policy)
+	}
+}
+
+func isAny(dep *k6deps.Dependency) bool {
+	return dep.GetConstraints().String() == k6deps.ConstraintsAny
+}
+
+// intersect returns a dependency with constraints satisfied only by the versions satisfying both dependencies.
+// As the "," (and) operator binds tighter than the "||" (or) operator, alternatives are distributed.
+func intersect(name string, dep1, dep2 *k6deps.Dependency) (*k6deps.Dependency, error) {
+	alternatives1 := strings.Split(dep1.GetConstraints().String(), "||")
+	alternatives2 := strings.Split(dep2.GetConstraints().String(), "||")
+
+	combined := make([]string, 0, len(alternatives1)*len(alternatives2))
+
+	for _, alt1 := range alternatives1 {
+		for _, alt2 := range alternatives2 {
+			combined = append(combined, strings.TrimSpace(alt1)+", "+strings.TrimSpace(alt2))
+		}
+	}
+
+	dep, err := k6deps.NewDependency(name, strings.Join(combined, " || "))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMergePolicy, err.Error())
+	}
+
+	return dep, nil
+}
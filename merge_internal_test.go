@@ -0,0 +1,76 @@
+package k6exec
+
+import (
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseMergePolicy(t *testing.T) {
+	t.Parallel()
+
+	for name, expected := range map[string]MergePolicy{
+		"":          MergeStrict,
+		"strict":    MergeStrict,
+		"override":  MergeOverride,
+		"intersect": MergeIntersect,
+	} {
+		policy, err := ParseMergePolicy(name)
+		require.NoError(t, err)
+		require.Equal(t, expected, policy)
+	}
+
+	_, err := ParseMergePolicy("union")
+	require.ErrorIs(t, err, ErrMergePolicy)
+}
+
+func TestMergePolicy_merge(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		policy  MergePolicy
+		sources []string
+		want    string
+		wantErr bool
+	}{
+		{name: "strict", policy: MergeStrict, sources: []string{"k6>0.54.0;k6/x/faker*", "k6/x/faker>0.4.0"}, want: "k6>0.54.0;k6/x/faker>0.4.0"},
+		{name: "strict conflict", policy: MergeStrict, sources: []string{"k6/x/faker>0.4.0", "k6/x/faker>0.3.0"}, wantErr: true},
+		{name: "override", policy: MergeOverride, sources: []string{"k6/x/faker>0.4.0", "k6/x/faker=v0.3.0"}, want: "k6/x/faker=v0.3.0"},
+		{name: "override any", policy: MergeOverride, sources: []string{"k6/x/faker>0.4.0", "k6/x/faker*"}, want: "k6/x/faker>0.4.0"},
+		{name: "override order", policy: MergeOverride, sources: []string{"k6>0.50.0", "k6<0.60.0", "k6=v0.55.0"}, want: "k6=v0.55.0"},
+		{name: "intersect", policy: MergeIntersect, sources: []string{"k6>0.50.0", "k6/x/faker*", "k6<0.60.0;k6/x/faker>0.4.0"}, want: "k6>0.50.0 <0.60.0;k6/x/faker>0.4.0"},
+		{name: "intersect alternatives", policy: MergeIntersect, sources: []string{"k6<0.50.0 || >0.55.0", "k6<0.60.0"}, want: "k6<0.50.0 <0.60.0 || >0.55.0 <0.60.0"},
+		{name: "unknown", policy: MergePolicy("union"), sources: []string{"k6>0.50.0"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			merged := make(k6deps.Dependencies)
+
+			var err error
+
+			for _, src := range tt.sources {
+				var deps k6deps.Dependencies
+
+				require.NoError(t, deps.UnmarshalText([]byte(src)))
+
+				if err = tt.policy.merge(merged, deps); err != nil {
+					break
+				}
+			}
+
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, merged.String())
+		})
+	}
+}
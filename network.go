@@ -0,0 +1,125 @@
+package k6exec
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// ErrNetworkConfig is returned when the proxy, the CA certificates or the client certificate cannot be used.
+var ErrNetworkConfig = errors.New("network configuration error")
+
+type httpClientKey struct{}
+
+// withNetworkConfig returns a context passing the HTTP client used by k6exec for its requests
+// (build service, k6 executable, remote scripts, extension catalog, signatures), configured using the proxy,
+// the CA certificates and the client certificate set in the options.
+// The returned function closes the idle connections of the client.
+// If none of them is set, the default HTTP client is used.
+func withNetworkConfig(ctx context.Context, opts *Options) (context.Context, func(), error) {
+	if ctx.Value(httpClientKey{}) != nil || !hasNetworkConfig(opts) {
+		return ctx, func() {}, nil
+	}
+
+	transport, err := newTransport(opts)
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	return context.WithValue(ctx, httpClientKey{}, &http.Client{Transport: transport}), transport.CloseIdleConnections, nil
+}
+
+// httpClient returns the HTTP client passed in the context, or the default HTTP client.
+func httpClient(ctx context.Context) *http.Client {
+	if client, ok := ctx.Value(httpClientKey{}).(*http.Client); ok {
+		return client
+	}
+
+	return http.DefaultClient
+}
+
+func hasNetworkConfig(opts *Options) bool {
+	return len(opts.ProxyURL) > 0 || len(opts.CACertFile) > 0 || len(opts.ClientCertFile) > 0
+}
+
+// newTransport returns a copy of the default HTTP transport, using the proxy, the CA certificates
+// and the client certificate set in the options. k6exec uses such a transport for all of its requests,
+// including the ones to the build service and the download of the k6 executable.
+func newTransport(opts *Options) (*http.Transport, error) {
+	transport := baseTransport()
+
+	if len(opts.ProxyURL) > 0 {
+		proxy, err := url.Parse(opts.ProxyURL)
+		if err != nil || len(proxy.Host) == 0 {
+			return nil, fmt.Errorf("%w: invalid proxy URL %q", ErrNetworkConfig, opts.ProxyURL)
+		}
+
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if len(opts.CACertFile) == 0 && len(opts.ClientCertFile) == 0 {
+		return transport, nil
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = new(tls.Config)
+	}
+
+	if len(opts.CACertFile) > 0 {
+		pool, err := loadCACerts(opts.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	if len(opts.ClientCertFile) > 0 {
+		keyFile := opts.ClientKeyFile
+		if len(keyFile) == 0 {
+			keyFile = opts.ClientCertFile
+		}
+
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: client certificate: %s", ErrNetworkConfig, err.Error())
+		}
+
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return transport, nil
+}
+
+// loadCACerts returns the system CA certificates and the CA certificates read from the PEM file.
+func loadCACerts(filename string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(filename) //nolint:forbidigo,gosec
+	if err != nil {
+		return nil, fmt.Errorf("%w: CA certificates: %s", ErrNetworkConfig, err.Error())
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: CA certificates: no certificate found in %s", ErrNetworkConfig, filename)
+	}
+
+	return pool, nil
+}
+
+// baseTransport returns a copy of the default transport.
+func baseTransport() *http.Transport {
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		return transport.Clone()
+	}
+
+	return &http.Transport{Proxy: http.ProxyFromEnvironment}
+}
@@ -0,0 +1,309 @@
+package k6exec
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6deps"
+	"github.com/grafana/k6exec/internal/k6exectest"
+	"github.com/stretchr/testify/require"
+)
+
+// writePEM writes the PEM encoded blocks to a file in dir, returning its path.
+func writePEM(t *testing.T, dir string, name string, blocks ...*pem.Block) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+
+	var data []byte
+
+	for _, block := range blocks {
+		data = append(data, pem.EncodeToMemory(block)...)
+	}
+
+	require.NoError(t, os.WriteFile(path, data, 0o600)) //nolint:forbidigo
+
+	return path
+}
+
+// newClientCert returns a self-signed client certificate and its PEM encoded blocks.
+func newClientCert(t *testing.T) (*x509.Certificate, *pem.Block, *pem.Block) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "k6exec"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return cert, &pem.Block{Type: "CERTIFICATE", Bytes: der}, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}
+}
+
+func get(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := httpClient(ctx).Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	body, err := io.ReadAll(resp.Body)
+
+	return string(body), err
+}
+
+func Test_withNetworkConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	clientCert, certBlock, keyBlock := newClientCert(t)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+
+	t.Cleanup(srv.Close)
+
+	caFile := writePEM(t, dir, "ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	certFile := writePEM(t, dir, "cert.pem", certBlock)
+	keyFile := writePEM(t, dir, "key.pem", keyBlock)
+	combinedFile := writePEM(t, dir, "combined.pem", certBlock, keyBlock)
+
+	t.Run("untrusted server", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, release, err := withNetworkConfig(context.Background(), &Options{ClientCertFile: certFile, ClientKeyFile: keyFile})
+		require.NoError(t, err)
+
+		t.Cleanup(release)
+
+		_, err = get(ctx, srv.URL)
+		require.Error(t, err)
+	})
+
+	t.Run("missing client certificate", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, release, err := withNetworkConfig(context.Background(), &Options{CACertFile: caFile})
+		require.NoError(t, err)
+
+		t.Cleanup(release)
+
+		_, err = get(ctx, srv.URL)
+		require.Error(t, err)
+	})
+
+	t.Run("mutual TLS", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, release, err := withNetworkConfig(context.Background(), &Options{
+			CACertFile:     caFile,
+			ClientCertFile: certFile,
+			ClientKeyFile:  keyFile,
+		})
+		require.NoError(t, err)
+
+		t.Cleanup(release)
+
+		body, err := get(ctx, srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, "ok", body)
+	})
+
+	t.Run("combined client certificate and key", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, release, err := withNetworkConfig(context.Background(), &Options{CACertFile: caFile, ClientCertFile: combinedFile})
+		require.NoError(t, err)
+
+		t.Cleanup(release)
+
+		// applied only once
+		ctx, _, err = withNetworkConfig(ctx, &Options{})
+		require.NoError(t, err)
+
+		body, err := get(ctx, srv.URL)
+		require.NoError(t, err)
+		require.Equal(t, "ok", body)
+	})
+
+	t.Run("proxy", func(t *testing.T) {
+		t.Parallel()
+
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "proxied "+r.URL.String())
+		}))
+
+		t.Cleanup(proxy.Close)
+
+		ctx, release, err := withNetworkConfig(context.Background(), &Options{ProxyURL: proxy.URL})
+		require.NoError(t, err)
+
+		t.Cleanup(release)
+
+		body, err := get(ctx, "http://build.example.com/build")
+		require.NoError(t, err)
+		require.Equal(t, "proxied http://build.example.com/build", body)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		for _, opts := range []*Options{
+			{ProxyURL: "::invalid"},
+			{CACertFile: filepath.Join(dir, "missing.pem")},
+			{CACertFile: keyFile},
+			{ClientCertFile: certFile},
+		} {
+			_, _, err := withNetworkConfig(context.Background(), opts)
+			require.ErrorIs(t, err, ErrNetworkConfig)
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, release, err := withNetworkConfig(context.Background(), &Options{})
+		require.NoError(t, err)
+
+		t.Cleanup(release)
+		require.Same(t, http.DefaultClient, httpClient(ctx))
+	})
+}
+
+func Test_buildServiceProvisioner_proxy(t *testing.T) {
+	t.Parallel()
+
+	svc := newBuildService(t, nil)
+
+	var proxied atomic.Int32
+
+	// the requests sent to a proxy contain the absolute URL
+	proxy := httptest.NewServer(&httputil.ReverseProxy{Rewrite: func(r *httputil.ProxyRequest) {
+		proxied.Add(1)
+
+		r.Out.URL = r.In.URL
+	}})
+
+	t.Cleanup(proxy.Close)
+
+	k6, err := k6deps.NewDependency(k6deps.NameK6, k6deps.ConstraintsAny)
+	require.NoError(t, err)
+
+	opts := &Options{
+		BuildServiceURL: svc.URL,
+		ProxyURL:        proxy.URL,
+		CacheDir:        t.TempDir(),
+		BinaryCacheDir:  t.TempDir(),
+	}
+
+	binary, err := newBuildServiceProvisioner(opts, hostPlatform()).
+		Provision(context.Background(), k6deps.Dependencies{k6deps.NameK6: k6})
+	require.NoError(t, err)
+	require.FileExists(t, binary.Path)
+
+	// both the build request and the download of the k6 executable are sent through the proxy
+	require.Equal(t, int32(2), proxied.Load())
+}
+
+func Test_buildServiceProvisioner_tls(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	clientCert, certBlock, keyBlock := newClientCert(t)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	svc := newBuildService(t, &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	})
+
+	caFile := writePEM(t, dir, "ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: svc.Certificate().Raw})
+	certFile := writePEM(t, dir, "cert.pem", certBlock)
+	keyFile := writePEM(t, dir, "key.pem", keyBlock)
+
+	var deps k6deps.Dependencies
+
+	require.NoError(t, deps.UnmarshalText([]byte("k6/x/faker>0.3")))
+
+	opts := &Options{
+		Env:             k6deps.Source{Ignore: true},
+		Manifest:        k6deps.Source{Ignore: true},
+		BuildServiceURL: svc.URL,
+		CACertFile:      caFile,
+		ClientCertFile:  certFile,
+		ClientKeyFile:   keyFile,
+		Retries:         -1,
+		CacheDir:        t.TempDir(),
+		BinaryCacheDir:  t.TempDir(),
+	}
+
+	binary, err := ProvisionDependencies(context.Background(), deps, opts)
+	require.NoError(t, err)
+	require.FileExists(t, binary.Path)
+	require.Equal(t, k6exectest.K6Checksum, binary.Checksum)
+	require.False(t, binary.Cached)
+	require.Equal(t, int32(1), svc.downloads.Load())
+
+	// the downloaded k6 executable is reused
+	binary, err = ProvisionDependencies(context.Background(), deps, opts)
+	require.NoError(t, err)
+	require.True(t, binary.Cached)
+	require.Equal(t, int32(2), svc.builds.Load())
+	require.Equal(t, int32(1), svc.downloads.Load())
+
+	// the build service requires the client certificate
+	opts.ClientCertFile, opts.ClientKeyFile = "", ""
+
+	_, err = ProvisionDependencies(context.Background(), deps, opts)
+	require.ErrorIs(t, err, ErrBuildService)
+	require.Equal(t, int32(2), svc.builds.Load())
+}
@@ -1,6 +1,12 @@
 package k6exec
 
 import (
+	"context"
+	"crypto/ed25519"
+	"io"
+	"os"
+	"time"
+
 	"github.com/grafana/k6deps"
 )
 
@@ -24,6 +30,117 @@ type Options struct {
 	// for the manifest file from the current directory
 	// If missing, the closest manifest file will be used.
 	FindManifest func(scriptfile string) (filename string, ok bool, err error)
+	// CatalogURL contains the URL (or the file path) of the extension catalog,
+	// used to map the output names of the --out flag and the K6_OUT environment variable to extensions.
+	// If empty, DefaultCatalogURL is used.
+	CatalogURL string
+	// MergePolicy defines how the version constraints of a dependency found in several sources
+	// (script, manifest, environment variable) are merged. Defaults to MergeStrict.
+	MergePolicy MergePolicy
+	// Stdin is used to read the script (or archive) if the script argument is "-".
+	// The content read is replayed to the standard input of the k6 command.
+	// If nil, os.Stdin will be used.
+	Stdin io.Reader
+	// RemoteAuth contains the value of the Authorization header used to fetch remote (http or https) scripts.
+	RemoteAuth string
+	// RemoteTimeout contains the timeout for fetching a remote script. Defaults to 30 seconds.
+	RemoteTimeout time.Duration
+	// RemoteMaxSize contains the maximum size of a remote script in bytes. Defaults to 10 MiB.
+	RemoteMaxSize int64
+	// Lockfile contains the path of the lockfile, which pins the versions of k6 and the extensions,
+	// and the checksum of the k6 executable.
+	// If empty, the k6exec.lock file next to the manifest file (or the script) is used.
+	// The lockfile is used only by the k6 commands with a script (or an archive) argument.
+	Lockfile string
+	// LockfileMode defines how the lockfile is used. Defaults to LockfileAuto.
+	LockfileMode LockfileMode
+	// Offline disables the build service: only the k6 executables already provisioned
+	// (found in BinaryCacheDir or CacheDir) are used. An error is returned if none of them satisfies the dependencies.
+	Offline bool
+	// CacheDir specifies the directory where the provisioned k6 executables are recorded.
+	// If empty, the AppName directory in the user cache directory (os.UserCacheDir) is used.
+	CacheDir string
+	// BinaryCacheDir specifies the directory where the k6 executables provided by the build service are cached.
+	// If empty, the k6provider directory in the user cache directory is used (the default of k6provider).
+	BinaryCacheDir string
+	// BuildServices contains the build services to be used in order: if a build service is unavailable,
+	// the next one is used. If empty, the build service defined by BuildServiceURL and BuildServiceToken is used.
+	BuildServices []BuildService
+	// TrustedKeys contains the public keys trusted to sign the k6 executables provided by the build services
+	// (in addition to the trusted keys defined per build service in BuildServices). If not empty, a k6 executable
+	// without a valid signature of a trusted key is refused. In offline mode, the cached k6 executables must be
+	// signed by a key trusted by any build service, and the cached local builds must match their recorded checksum.
+	TrustedKeys []ed25519.PublicKey
+	// FailoverWindow contains the duration for which an unavailable build service is tried only
+	// after the other build services. Defaults to 5 minutes.
+	FailoverWindow time.Duration
+	// Retries contains the number of times provisioning using the build service is retried,
+	// if the build service responds with a transient error (e.g. 429, 502, 503) or it cannot be reached.
+	// Defaults to 3, negative value disables retries.
+	Retries int
+	// RetryBackoff contains the initial wait time between retries, which doubles on each retry (with jitter).
+	// If the build service sets the Retry-After header, it is waited for instead. Defaults to 1 second.
+	RetryBackoff time.Duration
+	// ProvisionTimeout contains the deadline of provisioning using the build service, including retries.
+	// Defaults to 10 minutes.
+	ProvisionTimeout time.Duration
+	// LocalBuild enables building the k6 executable locally, using the Go toolchain,
+	// if the build service is not set or it fails to provision the k6 executable.
+	// The Go modules of k6 and the extensions are resolved using LocalModules, falling back to
+	// the extension catalog (CatalogURL). The available versions are listed from the file based
+	// module proxies of GoProxy and the module cache, falling back to the extension catalog.
+	LocalBuild bool
+	// LocalModules contains the Go modules of the extensions used by the local build, indexed by
+	// dependency name (e.g. "k6/x/faker": "github.com/grafana/xk6-faker"). The Go module of k6 is known.
+	LocalModules map[string]string
+	// GoProxy contains the GOPROXY used by the local build. If empty, the GOPROXY of the Go environment is used.
+	// To build without network access, use a file based proxy (file://...) or "off" with a populated GoModCache.
+	GoProxy string
+	// GoModCache contains the GOMODCACHE directory used by the local build.
+	// If empty, the GOMODCACHE of the Go environment is used.
+	GoModCache string
+	// Provisioner is used to provision the k6 executable satisfying the dependencies.
+	// If nil, the k6 executable is provisioned using the build service
+	// (or from the already provisioned k6 executables in offline mode).
+	Provisioner Provisioner
+	// DownloadAuth contains the value of the Authorization header used to download the k6 executable
+	// (and its signature) from the artifact store of the build service. It is independent of BuildServiceToken.
+	// If empty, the K6_DOWNLOAD_AUTH environment variable is used.
+	DownloadAuth string
+	// DownloadHeaders contains additional HTTP headers used to download the k6 executable (and its signature).
+	DownloadHeaders map[string]string
+	// ProxyURL contains the URL of the HTTP proxy to be used for the requests of k6exec (build service,
+	// k6 executable, remote scripts, extension catalog, signatures). If empty, the proxy is taken from
+	// the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+	ProxyURL string
+	// CACertFile contains the path of a PEM file containing CA certificates trusted in addition to the system ones
+	// (e.g. the CA certificate of a TLS-intercepting proxy), for the requests of k6exec.
+	CACertFile string
+	// ClientCertFile contains the path of a PEM file containing the client certificate for mutual TLS,
+	// for the requests of k6exec (e.g. to a build service requiring mutual TLS).
+	ClientCertFile string
+	// ClientKeyFile contains the path of a PEM file containing the private key of the client certificate.
+	// If empty, the private key is read from ClientCertFile.
+	ClientKeyFile string
+	// Platform contains the platform (os/arch, e.g. linux/arm64) of the k6 executable to be provisioned.
+	// Defaults to the current platform. A k6 executable for another platform can be provisioned
+	// (e.g. to be copied into a container image), but it cannot be run: Command returns ErrPlatform.
+	Platform string
+	// Progress receives the progress of provisioning (waiting for the build and downloading),
+	// rendered on a single line rewritten in place, so it should be a terminal. If nil, no progress is rendered.
+	Progress io.Writer
+	// ProgressColor enables colors in the progress rendered to Progress.
+	ProgressColor bool
+	// LockTimeout contains the maximum time to wait for another process provisioning the same
+	// k6 executable (or updating the cache). Defaults to 15 minutes.
+	LockTimeout time.Duration
+	// CacheMaxSize contains the maximum total size of the cached k6 executables in bytes.
+	// The least recently used k6 executables exceeding it are removed after the k6 command is run.
+	// Zero means no limit.
+	CacheMaxSize int64
+	// CacheMaxAge contains the maximum time since a cached k6 executable was last used.
+	// The k6 executables exceeding it are removed after the k6 command is run. Zero means no limit.
+	CacheMaxAge time.Duration
 	// AppName contains the name of the application. It is used to define the default value of CacheDir.
 	// If empty, it defaults to os.Args[0].
 	AppName string
@@ -33,4 +150,24 @@ type Options struct {
 	// BuildServiceToken contains the token to be used to authenticate with the build service.
 	// Defaults to K6_CLOUD_TOKEN environment variable is set, or the value stored in the k6 config file.
 	BuildServiceToken string
+	// BuildServiceCredential is called to get the token of the build service defined by BuildServiceURL
+	// if BuildServiceToken is empty. It is called only when the build service is used.
+	BuildServiceCredential func(ctx context.Context) (string, error)
+}
+
+// platform returns the platform of the k6 executable to be provisioned.
+func (o *Options) platform() string {
+	if len(o.Platform) > 0 {
+		return o.Platform
+	}
+
+	return hostPlatform()
+}
+
+func (o *Options) stdin() io.Reader {
+	if o.Stdin != nil {
+		return o.Stdin
+	}
+
+	return os.Stdin //nolint:forbidigo
 }
@@ -0,0 +1,177 @@
+package k6exec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/grafana/k6deps"
+)
+
+const (
+	// DefaultCatalogURL is the URL of the default extension catalog.
+	DefaultCatalogURL = "https://registry.k6.io/catalog.json"
+
+	outputFlag   = "--out"
+	outputEnv    = "K6_OUT"
+	catalogCache = "catalog.json"
+)
+
+// ErrCatalog is returned when the extension catalog cannot be loaded.
+var ErrCatalog = errors.New("extension catalog error")
+
+// catalogEntry contains the Go module and the available versions of an extension (or k6) in the catalog.
+type catalogEntry struct {
+	Module   string   `json:"module"`
+	Versions []string `json:"versions"`
+}
+
+// builtinOutputs contains the names of the outputs built into the current k6 versions, which need no extension.
+// The outputs removed from k6 (e.g. kafka, statsd and its datadog alias) are provided by extensions.
+//
+//nolint:gochecknoglobals
+var builtinOutputs = []string{
+	"cloud",
+	"csv",
+	"experimental-opentelemetry",
+	"experimental-prometheus-rw",
+	"influxdb",
+	"json",
+	"opentelemetry",
+	"web-dashboard",
+}
+
+// analyzeOutputs returns the output extensions used by the --out flags and the K6_OUT environment variable.
+// The output names are mapped to extensions using the extension catalog, which is loaded only if
+// a non built-in output is used.
+func analyzeOutputs(ctx context.Context, args *Args, opts *Options) ([]*sourceDependencies, error) {
+	found := map[string][]string{outputFlag: outputNames(args.Flags["out"])}
+
+	lookupEnv := opts.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv //nolint:forbidigo
+	}
+
+	if value, ok := lookupEnv(outputEnv); ok {
+		found[outputEnv] = outputNames(strings.Split(value, ","))
+	}
+
+	var catalog map[string]catalogEntry
+
+	sources := make([]*sourceDependencies, 0, len(found))
+
+	for _, name := range []string{outputFlag, outputEnv} {
+		deps := make(k6deps.Dependencies)
+
+		for _, output := range found[name] {
+			if catalog == nil {
+				var err error
+
+				if catalog, err = loadCatalog(ctx, opts); err != nil {
+					return nil, err
+				}
+			}
+
+			if _, known := catalog[output]; !known {
+				slog.Debug("output not found in the extension catalog", "output", output)
+
+				continue
+			}
+
+			dep, err := k6deps.NewDependency(output, k6deps.ConstraintsAny)
+			if err != nil {
+				return nil, err
+			}
+
+			deps[output] = dep
+		}
+
+		if len(deps) > 0 {
+			sources = append(sources, &sourceDependencies{origin: OriginOutput, name: name, deps: deps})
+		}
+	}
+
+	return sources, nil
+}
+
+// outputNames returns the names of the non built-in outputs from the "name=config" output values.
+func outputNames(values []string) []string {
+	names := make([]string, 0, len(values))
+
+	for _, value := range values {
+		name, _, _ := strings.Cut(strings.TrimSpace(value), "=")
+		if len(name) > 0 && !slices.Contains(builtinOutputs, name) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// loadCatalog loads the extension catalog from Options.CatalogURL (an http(s) URL or a file).
+// The catalog fetched is cached in the cache directory, and the cached catalog is used
+// if the catalog cannot be fetched, or in offline mode.
+func loadCatalog(ctx context.Context, opts *Options) (map[string]catalogEntry, error) {
+	location := opts.CatalogURL
+	if len(location) == 0 {
+		location = DefaultCatalogURL
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+
+	switch {
+	case !isRemoteScript(location):
+		data, err = os.ReadFile(location) //nolint:forbidigo,gosec
+	case opts.Offline:
+		data, err = readCachedCatalog(opts)
+	default:
+		if data, err = download(ctx, "fetching extension catalog", location, nil, opts); err == nil {
+			writeCachedCatalog(data, opts)
+		} else if cached, cerr := readCachedCatalog(opts); cerr == nil {
+			slog.Debug("using cached extension catalog", "url", location, "error", err)
+
+			data, err = cached, nil
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrCatalog, location, err.Error())
+	}
+
+	var catalog map[string]catalogEntry
+
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrCatalog, location, err.Error())
+	}
+
+	return catalog, nil
+}
+
+func readCachedCatalog(opts *Options) ([]byte, error) {
+	dir, err := cacheDir(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(filepath.Join(dir, catalogCache)) //nolint:forbidigo
+}
+
+func writeCachedCatalog(data []byte, opts *Options) {
+	dir, err := cacheDir(opts)
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(dir, catalogCache), data)
+	}
+
+	if err != nil {
+		slog.Debug("extension catalog not cached", "error", err)
+	}
+}
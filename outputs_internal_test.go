@@ -0,0 +1,124 @@
+package k6exec
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/stretchr/testify/require"
+)
+
+const testCatalog = `{
+  "k6": {"module": "go.k6.io/k6", "versions": ["v0.57.0"]},
+  "top": {"module": "github.com/szkiba/xk6-top", "versions": ["v0.1.0"]},
+  "dashboard": {"module": "github.com/grafana/xk6-dashboard", "versions": ["v0.7.0"]},
+  "kafka": {"module": "github.com/grafana/xk6-output-kafka", "versions": ["v0.9.0"]}
+}`
+
+func Test_analyze_outputs(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	catalog := filepath.Join(dir, "catalog.json")
+
+	require.NoError(t, os.WriteFile(catalog, []byte(testCatalog), 0o600)) //nolint:forbidigo
+
+	env := map[string]string{"K6_OUT": "dashboard=port=5665,csv"}
+
+	opts := &Options{
+		Manifest:   k6deps.Source{Ignore: true},
+		Env:        k6deps.Source{Ignore: true},
+		CatalogURL: catalog,
+		LookupEnv: func(key string) (string, bool) {
+			value, found := env[key]
+
+			return value, found
+		},
+	}
+
+	args := []string{"run", "-o", "top", "--out", "json=results.json", "--out=unknown", "examples/combined.js"}
+
+	analysis, err := Analyze(context.Background(), args, opts)
+	require.NoError(t, err)
+
+	require.Contains(t, analysis.Dependencies, "top")
+	require.Contains(t, analysis.Dependencies, "dashboard")
+	require.NotContains(t, analysis.Dependencies, "json")
+	require.NotContains(t, analysis.Dependencies, "unknown")
+
+	require.Equal(t,
+		[]DependencySource{{Origin: OriginOutput, Name: "--out", Constraints: "*"}},
+		analysis.Sources["top"],
+	)
+	require.Equal(t,
+		[]DependencySource{{Origin: OriginOutput, Name: "K6_OUT", Constraints: "*"}},
+		analysis.Sources["dashboard"],
+	)
+
+	// the outputs removed from k6 are provided by extensions
+	analysis, err = Analyze(context.Background(), []string{"run", "--out", "kafka=brokers=localhost", "examples/combined.js"}, opts)
+	require.NoError(t, err)
+	require.Contains(t, analysis.Dependencies, "kafka")
+	require.Equal(t,
+		[]DependencySource{{Origin: OriginOutput, Name: "--out", Constraints: "*"}},
+		analysis.Sources["kafka"],
+	)
+
+	// built-in outputs need no catalog
+	opts.CatalogURL = filepath.Join(dir, "missing.json")
+	env = map[string]string{}
+
+	_, err = Analyze(context.Background(), []string{"run", "--out", "json", "examples/combined.js"}, opts)
+	require.NoError(t, err)
+
+	_, err = Analyze(context.Background(), []string{"run", "--out", "top", "examples/combined.js"}, opts)
+	require.ErrorIs(t, err, ErrCatalog)
+}
+
+func Test_loadCatalog(t *testing.T) {
+	t.Parallel()
+
+	var available atomic.Bool
+
+	available.Store(true)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(testCatalog))
+	}))
+
+	t.Cleanup(srv.Close)
+
+	opts := &Options{CacheDir: t.TempDir(), CatalogURL: srv.URL + "/catalog.json"}
+
+	// offline without cached catalog
+	_, err := loadCatalog(context.Background(), &Options{CacheDir: opts.CacheDir, CatalogURL: opts.CatalogURL, Offline: true})
+	require.ErrorIs(t, err, ErrCatalog)
+
+	catalog, err := loadCatalog(context.Background(), opts)
+	require.NoError(t, err)
+	require.Contains(t, catalog, "top")
+
+	// cached catalog is used if the catalog is not available
+	available.Store(false)
+
+	catalog, err = loadCatalog(context.Background(), opts)
+	require.NoError(t, err)
+	require.Contains(t, catalog, "top")
+
+	opts.Offline = true
+
+	catalog, err = loadCatalog(context.Background(), opts)
+	require.NoError(t, err)
+	require.Contains(t, catalog, "top")
+}
@@ -0,0 +1,233 @@
+package k6exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressInterval = 200 * time.Millisecond
+
+	// clearLine moves the cursor to the beginning of the line and erases the line.
+	clearLine  = "\r\033[K"
+	colorCyan  = "\033[36m"
+	colorReset = "\033[0m"
+)
+
+//nolint:gochecknoglobals
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+type progressKey struct{}
+
+// progress renders the progress of provisioning (waiting for the k6 executable to be built,
+// downloading it and the related files) on a single, repeatedly rewritten line of a terminal.
+type progress struct {
+	out   io.Writer
+	color bool
+
+	mu       sync.Mutex
+	label    string
+	started  time.Time
+	download bool
+	current  int64
+	total    int64
+	frame    int
+	shown    bool
+}
+
+// startProgress starts rendering the progress to Options.Progress, if it is set.
+// The returned context passes the progress to the provisioners, the returned function stops rendering.
+func startProgress(ctx context.Context, opts *Options) (context.Context, func()) {
+	if opts.Progress == nil {
+		return ctx, func() {}
+	}
+
+	p := &progress{out: opts.Progress, color: opts.ProgressColor}
+
+	ctx = context.WithValue(ctx, progressKey{}, p)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				p.render(now)
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return ctx, func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+
+			p.clear()
+		})
+	}
+}
+
+// progressFromContext returns the progress passed in the context, or nil.
+// The methods of a nil progress do nothing.
+func progressFromContext(ctx context.Context) *progress {
+	p, _ := ctx.Value(progressKey{}).(*progress)
+
+	return p
+}
+
+// wait shows waiting for the labeled activity, until the returned function is called.
+func (p *progress) wait(label string) func() {
+	if p == nil {
+		return func() {}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.label, p.started, p.download = label, time.Now(), false
+
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if p.label == label && !p.download {
+			p.label = ""
+		}
+	}
+}
+
+// track shows the progress of the labeled download, reading the body of total size (-1 if unknown).
+// The returned body reports the bytes read, and closing it ends showing the download.
+func (p *progress) track(label string, body io.ReadCloser, total int64) io.ReadCloser {
+	if p == nil {
+		return body
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.label, p.started, p.download = label, time.Now(), true
+	p.current, p.total = 0, total
+
+	return &progressReader{ReadCloser: body, progress: p}
+}
+
+func (p *progress) add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.current += int64(n)
+}
+
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.download {
+		p.label, p.download = "", false
+	}
+}
+
+func (p *progress) render(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.label) == 0 {
+		p.clearLocked()
+
+		return
+	}
+
+	p.frame++
+	p.shown = true
+
+	_, _ = io.WriteString(p.out, clearLine+p.line(now))
+}
+
+func (p *progress) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clearLocked()
+}
+
+func (p *progress) clearLocked() {
+	if p.shown {
+		_, _ = io.WriteString(p.out, clearLine)
+
+		p.shown = false
+	}
+}
+
+// line returns the progress line: a spinner, the label and either the time elapsed,
+// or the size downloaded, the download rate and the estimated time remaining.
+func (p *progress) line(now time.Time) string {
+	spinner := spinnerFrames[p.frame%len(spinnerFrames)]
+	if p.color {
+		spinner = colorCyan + spinner + colorReset
+	}
+
+	elapsed := now.Sub(p.started)
+
+	if !p.download {
+		return fmt.Sprintf("%s %s %s", spinner, p.label, elapsed.Truncate(time.Second))
+	}
+
+	var buff strings.Builder
+
+	fmt.Fprintf(&buff, "%s %s %s", spinner, p.label, FormatSize(p.current))
+
+	if p.total > 0 {
+		fmt.Fprintf(&buff, " / %s", FormatSize(p.total))
+	}
+
+	if elapsed < time.Second || p.current == 0 {
+		return buff.String()
+	}
+
+	rate := float64(p.current) / elapsed.Seconds()
+
+	fmt.Fprintf(&buff, " %s/s", FormatSize(int64(rate)))
+
+	if p.total > p.current {
+		eta := time.Duration(float64(p.total-p.current) / rate * float64(time.Second))
+
+		fmt.Fprintf(&buff, " ETA %s", eta.Round(time.Second))
+	}
+
+	return buff.String()
+}
+
+// progressReader reports the bytes read from a download to the progress.
+type progressReader struct {
+	io.ReadCloser
+	progress *progress
+}
+
+func (r *progressReader) Read(buff []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buff)
+
+	r.progress.add(n)
+
+	return n, err
+}
+
+func (r *progressReader) Close() error {
+	r.progress.finish()
+
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,138 @@
+package k6exec
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu   sync.Mutex
+	buff bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buff.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buff.String()
+}
+
+func Test_progress_line(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		progress *progress
+		expected string
+	}{
+		{
+			name:     "waiting",
+			progress: &progress{label: "waiting", started: now.Add(-12500 * time.Millisecond)},
+			expected: "⠋ waiting 12s",
+		},
+		{
+			name:     "colored",
+			progress: &progress{label: "waiting", started: now, color: true},
+			expected: colorCyan + "⠋" + colorReset + " waiting 0s",
+		},
+		{
+			name: "download started",
+			progress: &progress{
+				label: "downloading", started: now, download: true, current: 512, total: 4 << 20,
+			},
+			expected: "⠋ downloading 512 B / 4.0 MiB",
+		},
+		{
+			name: "download",
+			progress: &progress{
+				label: "downloading", started: now.Add(-2 * time.Second), download: true, current: 2 << 20, total: 6 << 20,
+			},
+			expected: "⠋ downloading 2.0 MiB / 6.0 MiB 1.0 MiB/s ETA 4s",
+		},
+		{
+			name: "unknown size",
+			progress: &progress{
+				label: "downloading", started: now.Add(-2 * time.Second), download: true, current: 2 << 20, total: -1,
+			},
+			expected: "⠋ downloading 2.0 MiB 1.0 MiB/s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.expected, tt.progress.line(now))
+		})
+	}
+}
+
+func Test_startProgress(t *testing.T) {
+	t.Parallel()
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, stop := startProgress(context.Background(), &Options{})
+		defer stop()
+
+		require.Nil(t, progressFromContext(ctx))
+		progressFromContext(ctx).wait("nothing")()
+	})
+
+	t.Run("download", func(t *testing.T) {
+		t.Parallel()
+
+		payload := strings.Repeat("k6", 64<<10)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, payload[:len(payload)/2])
+
+			w.(http.Flusher).Flush()
+
+			time.Sleep(3 * progressInterval)
+
+			_, _ = io.WriteString(w, payload[len(payload)/2:])
+		}))
+
+		defer srv.Close()
+
+		out := new(syncBuffer)
+
+		ctx, stop := startProgress(context.Background(), &Options{Progress: out})
+
+		require.NotNil(t, progressFromContext(ctx))
+
+		data, err := download(ctx, "fetching extension catalog", srv.URL, nil, &Options{})
+		require.NoError(t, err)
+		require.Len(t, data, len(payload))
+
+		stop()
+
+		rendered := out.String()
+
+		require.Contains(t, rendered, "fetching extension catalog")
+		require.NotContains(t, rendered, "k6 binary")
+		require.True(t, strings.HasSuffix(rendered, clearLine))
+		require.NotContains(t, rendered, colorCyan)
+	})
+}
@@ -2,35 +2,251 @@ package k6exec
 
 import (
 	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/grafana/k6deps"
-	"github.com/grafana/k6provider"
 )
 
-func provision(ctx context.Context, deps k6deps.Dependencies, opts *Options) (string, error) {
-	config := k6provider.Config{}
+// ErrPlatform is returned when the platform of the k6 executable is invalid,
+// or a k6 executable for another platform would be run.
+var ErrPlatform = errors.New("platform error")
 
-	if opts != nil {
-		config.BuildServiceURL = opts.BuildServiceURL
-		config.BuildServiceAuth = opts.BuildServiceToken
+// Binary contains the properties of a provisioned k6 executable.
+type Binary struct {
+	// Path contains the path of the k6 executable.
+	Path string
+	// Dependencies contains the resolved version of k6 and the extensions, indexed by name.
+	Dependencies map[string]string
+	// Checksum contains the SHA-256 checksum of the k6 executable.
+	Checksum string
+	// Cached is true if the k6 executable was already available locally.
+	Cached bool
+
+	// downloadURL contains the URL the k6 executable was downloaded from, if it is known.
+	downloadURL string
+	// trustedKeys contains the keys trusted to sign the k6 executable. If empty, it is not verified.
+	trustedKeys []ed25519.PublicKey
+}
+
+// setChecksum calculates the checksum of the k6 executable, if it is not known.
+func (binary *Binary) setChecksum() error {
+	if len(binary.Checksum) > 0 {
+		return nil
+	}
+
+	var err error
+
+	binary.Checksum, err = checksum(binary.Path)
+
+	return err
+}
+
+// Provisioner provisions a k6 executable satisfying the dependencies.
+type Provisioner interface {
+	// Provision returns a k6 executable satisfying the dependencies.
+	Provision(ctx context.Context, deps k6deps.Dependencies) (*Binary, error)
+}
+
+// provision provisions the k6 executable using Options.Provisioner,
+// or the build service (or the cached binaries in offline mode) if it is not set.
+func provision(ctx context.Context, deps k6deps.Dependencies, opts *Options) (*Binary, error) {
+	if err := checkPlatform(opts.platform()); err != nil {
+		return nil, err
+	}
+
+	provisioner := opts.Provisioner
+	if provisioner == nil {
+		provisioner = newProvisioner(opts)
+	}
+
+	ctx, release, err := withNetworkConfig(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	ctx, stop := startProgress(ctx, opts)
+	defer stop()
+
+	return provisioner.Provision(ctx, deps)
+}
+
+// newProvisioner returns the default provisioner for the given options.
+func newProvisioner(opts *Options) Provisioner {
+	platform := opts.platform()
+
+	var provisioners []Provisioner
+
+	switch {
+	case opts.Offline:
+		provisioners = append(provisioners, &offlineProvisioner{opts: opts, platform: platform})
+	case len(opts.BuildServiceURL) > 0 || len(opts.BuildServices) > 0 || !opts.LocalBuild:
+		provisioners = append(provisioners, newBuildServiceProvisioner(opts, platform))
+	}
+
+	if opts.LocalBuild {
+		provisioners = append(provisioners, newLocalProvisioner(opts, platform))
+	}
+
+	var provisioner Provisioner = fallbackProvisioner(provisioners)
+	if len(provisioners) == 1 {
+		provisioner = provisioners[0]
+	}
+
+	return &recordingProvisioner{provisioner: provisioner, opts: opts, platform: platform}
+}
+
+// recordingProvisioner verifies the provisioned k6 executable, and records it in the cache index.
+type recordingProvisioner struct {
+	provisioner Provisioner
+	opts        *Options
+	platform    string
+}
+
+func (p *recordingProvisioner) Provision(ctx context.Context, deps k6deps.Dependencies) (*Binary, error) {
+	binary, err := p.provisioner.Provision(ctx, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyBinary(ctx, binary, p.opts); err != nil {
+		return nil, err
+	}
+
+	recordBinary(binary, p.platform, p.opts)
+
+	return binary, nil
+}
+
+// hostPlatform returns the platform (os/arch) k6exec is running on.
+func hostPlatform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// checkPlatform checks the format (os/arch) of the platform.
+func checkPlatform(platform string) error {
+	goos, goarch, found := strings.Cut(platform, "/")
+	if !found || len(goos) == 0 || len(goarch) == 0 || strings.Contains(goarch, "/") {
+		return fmt.Errorf("%w: invalid platform %q, expected os/arch (e.g. linux/arm64)", ErrPlatform, platform)
+	}
+
+	return nil
+}
+
+// fallbackProvisioner tries the provisioners in order, until one of them succeeds.
+// A k6 executable refused because of its signature is never replaced by falling back.
+type fallbackProvisioner []Provisioner
+
+func (p fallbackProvisioner) Provision(ctx context.Context, deps k6deps.Dependencies) (*Binary, error) {
+	errs := make([]error, 0, len(p))
+
+	for _, provisioner := range p {
+		binary, err := provisioner.Provision(ctx, deps)
+		if err == nil {
+			return binary, nil
+		}
+
+		if errors.Is(err, ErrSignature) {
+			return nil, err
+		}
+
+		slog.Debug("provisioning failed, falling back", "error", err)
+
+		errs = append(errs, err)
 	}
 
-	provider, err := k6provider.NewProvider(config)
+	return nil, errors.Join(errs...)
+}
+
+// newBuildServiceProvisioner returns the provisioner using the build services, with retries and failover.
+func newBuildServiceProvisioner(opts *Options, platform string) Provisioner {
+	services := buildServices(opts)
+	provisioners := make([]Provisioner, 0, len(services))
+
+	for _, service := range services {
+		provisioners = append(provisioners,
+			newRetryProvisioner(&buildServiceProvisioner{service: service, opts: opts, platform: platform}, opts),
+		)
+	}
+
+	if len(provisioners) == 1 {
+		return provisioners[0]
+	}
+
+	return &failoverProvisioner{services: services, provisioners: provisioners, opts: opts}
+}
+
+// buildServiceProvisioner provisions the k6 executable using the build service. The downloaded k6 executables
+// are cached in Options.BinaryCacheDir, in the layout of k6provider (a directory per build service artifact).
+type buildServiceProvisioner struct {
+	service  BuildService
+	opts     *Options
+	platform string
+}
+
+func (p *buildServiceProvisioner) Provision(ctx context.Context, deps k6deps.Dependencies) (*Binary, error) {
+	bindir, err := binaryCacheDir(p.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the requests are sent using the proxy, the CA certificates and the client certificate of the options,
+	// unless the caller already passes the HTTP client
+	ctx, release, err := withNetworkConfig(ctx, p.opts)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	slog.Debug("fetching binary", "build service URL: ", opts.BuildServiceURL)
+	defer release()
+
+	slog.Debug("fetching binary", "build service URL: ", p.service.URL)
+
+	stop := progressFromContext(ctx).wait("waiting for the k6 binary to be built")
+	art, err := requestArtifact(ctx, p.service.URL, token, p.platform, deps)
+
+	stop()
 
-	binary, err := provider.GetBinary(ctx, deps)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	binary := &Binary{
+		Path:         filepath.Join(bindir, art.ID, executableName(p.platform)),
+		Dependencies: art.Dependencies,
+		Checksum:     art.Checksum,
+		downloadURL:  art.URL,
+		trustedKeys:  p.service.TrustedKeys,
+	}
+
+	// the artifact is downloaded by one process, the others wait for it and reuse it
+	unlock, err := lockExecutable(ctx, binary.Path, p.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	if _, err := os.Stat(binary.Path); err == nil { //nolint:forbidigo
+		binary.Cached = true
+	} else if err := downloadArtifact(ctx, art, binary.Path, p.opts); err != nil {
+		return nil, err
 	}
 
 	// Cut the query string from the download URL to reduce noise in the logs
-	downloadURL, _, _ := strings.Cut(binary.DownloadURL, "?")
+	downloadURL, _, _ := strings.Cut(art.URL, "?")
 	slog.Debug("binary fetched",
 		"Path: ", binary.Path,
 		"dependencies", deps.String(),
@@ -39,5 +255,42 @@ func provision(ctx context.Context, deps k6deps.Dependencies, opts *Options) (st
 		"download URL", downloadURL,
 	)
 
-	return binary.Path, nil
+	return binary, nil
+}
+
+// token returns the token of the build service. The token of the build service defined by
+// Options.BuildServiceURL is resolved by Options.BuildServiceCredential, if it is not given.
+func (p *buildServiceProvisioner) token(ctx context.Context) (string, error) {
+	if len(p.service.Token) > 0 || len(p.opts.BuildServices) > 0 || p.opts.BuildServiceCredential == nil {
+		return p.service.Token, nil
+	}
+
+	return p.opts.BuildServiceCredential(ctx)
+}
+
+// offlineProvisioner returns the cached k6 binary satisfying the dependencies, without using the build service.
+type offlineProvisioner struct {
+	opts     *Options
+	platform string
+}
+
+func (p *offlineProvisioner) Provision(_ context.Context, deps k6deps.Dependencies) (*Binary, error) {
+	index, release, err := syncBinaryIndex(p.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	cached, err := index.find(deps, p.platform)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("using cached binary", "path", cached.Path, "dependencies", deps.String(), "checksum", cached.Checksum)
+
+	binary := cached.binary()
+	binary.trustedKeys = allTrustedKeys(p.opts)
+
+	return binary, nil
 }
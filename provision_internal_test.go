@@ -0,0 +1,65 @@
+package k6exec
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkPlatform(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, checkPlatform("linux/arm64"))
+	require.NoError(t, checkPlatform(hostPlatform()))
+
+	for _, platform := range []string{"", "linux", "linux/", "/arm64", "linux/arm/v7"} {
+		require.ErrorIs(t, checkPlatform(platform), ErrPlatform, platform)
+	}
+
+	require.Equal(t, "linux/arm64", (&Options{Platform: "linux/arm64"}).platform())
+	require.Equal(t, hostPlatform(), (&Options{}).platform())
+}
+
+func Test_buildServiceProvisioner_token(t *testing.T) {
+	t.Parallel()
+
+	var calls int
+
+	opts := &Options{
+		BuildServiceURL: "https://build.example.com",
+		BuildServiceCredential: func(context.Context) (string, error) {
+			calls++
+
+			return "resolved", nil
+		},
+	}
+
+	token, err := (&buildServiceProvisioner{service: buildServices(opts)[0], opts: opts}).token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "resolved", token)
+	require.Equal(t, 1, calls)
+
+	// the credential is not resolved if the token is given
+	opts.BuildServiceToken = "given"
+
+	token, err = (&buildServiceProvisioner{service: buildServices(opts)[0], opts: opts}).token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "given", token)
+
+	// nor for the build services given explicitly
+	opts.BuildServices = []BuildService{{URL: "https://other.example.com"}}
+
+	token, err = (&buildServiceProvisioner{service: buildServices(opts)[0], opts: opts}).token(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, token)
+	require.Equal(t, 1, calls)
+
+	// the errors of the credential are returned
+	errCredential := errors.New("credential error")
+	opts = &Options{BuildServiceCredential: func(context.Context) (string, error) { return "", errCredential }}
+
+	_, err = (&buildServiceProvisioner{service: buildServices(opts)[0], opts: opts}).token(context.Background())
+	require.ErrorIs(t, err, errCredential)
+}
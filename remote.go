@@ -0,0 +1,178 @@
+package k6exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRemoteTimeout = 30 * time.Second
+	defaultRemoteMaxSize = 10 * 1024 * 1024 // 10M
+)
+
+// ErrRemoteScript is returned when a remote script cannot be fetched.
+var ErrRemoteScript = errors.New("remote script error")
+
+const remoteCacheSize = 8
+
+// remoteScript is a remote script fetched (or being fetched): done is closed once it is fetched.
+type remoteScript struct {
+	key     string
+	done    chan struct{}
+	content []byte
+	err     error
+}
+
+// remoteScripts caches the content of the remote scripts recently fetched,
+// so the same URL is not downloaded more than once per run.
+// The content is indexed by the URL and the authorization used to fetch it,
+// so it is only returned to callers fetching the script with the same credentials.
+//
+//nolint:gochecknoglobals
+var remoteScripts = struct {
+	sync.Mutex
+	entries []*remoteScript
+}{}
+
+func isRemoteScript(name string) bool {
+	return strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "http://")
+}
+
+// fetchScript returns the content of the remote script with the given URL.
+// Concurrent callers fetching the same script wait for a single download, without blocking the other scripts.
+func fetchScript(ctx context.Context, url string, opts *Options) ([]byte, error) {
+	key := url + "\x00" + opts.RemoteAuth
+
+	for {
+		entry, fetching := acquireRemoteScript(key)
+		if fetching {
+			entry.content, entry.err = download(ctx, "fetching remote script", url, authHeader(opts.RemoteAuth), opts)
+			if entry.err != nil {
+				releaseRemoteScript(entry)
+
+				entry.err = fmt.Errorf("%w: %s: %w", ErrRemoteScript, url, entry.err)
+			}
+
+			close(entry.done)
+
+			return entry.content, entry.err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-entry.done:
+		}
+
+		// a failed download is not cached, it is retried by the next caller
+		if entry.err == nil {
+			slog.Debug("using cached remote script", "url", url)
+
+			return entry.content, nil
+		}
+	}
+}
+
+// acquireRemoteScript returns the cached entry of the script, or a new entry to be fetched by the caller.
+// The least recently added entries exceeding the size of the cache are dropped.
+func acquireRemoteScript(key string) (*remoteScript, bool) {
+	remoteScripts.Lock()
+	defer remoteScripts.Unlock()
+
+	for _, entry := range remoteScripts.entries {
+		if entry.key == key {
+			return entry, false
+		}
+	}
+
+	entry := &remoteScript{key: key, done: make(chan struct{})}
+
+	remoteScripts.entries = append(remoteScripts.entries, entry)
+	if len(remoteScripts.entries) > remoteCacheSize {
+		remoteScripts.entries = slices.Delete(remoteScripts.entries, 0, len(remoteScripts.entries)-remoteCacheSize)
+	}
+
+	return entry, true
+}
+
+// releaseRemoteScript removes the entry from the cache.
+func releaseRemoteScript(entry *remoteScript) {
+	remoteScripts.Lock()
+	defer remoteScripts.Unlock()
+
+	remoteScripts.entries = slices.DeleteFunc(remoteScripts.entries, func(other *remoteScript) bool {
+		return other == entry
+	})
+}
+
+// authHeader returns the header containing auth as the Authorization header, or nil if auth is empty.
+func authHeader(auth string) http.Header {
+	if len(auth) == 0 {
+		return nil
+	}
+
+	return http.Header{"Authorization": []string{auth}}
+}
+
+// download returns the content of the given URL, sending the given header.
+// The label describes the purpose of the download in the progress.
+func download(ctx context.Context, label string, url string, header http.Header, opts *Options) ([]byte, error) {
+	timeout := opts.RemoteTimeout
+	if timeout == 0 {
+		timeout = defaultRemoteTimeout
+	}
+
+	maxSize := opts.RemoteMaxSize
+	if maxSize == 0 {
+		maxSize = defaultRemoteMaxSize
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	slog.Debug("fetching", "url", url)
+
+	resp, err := httpClient(ctx).Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body := progressFromContext(ctx).track(label, resp.Body, resp.ContentLength)
+	defer body.Close() //nolint:errcheck
+
+	content, err := io.ReadAll(io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("size exceeds the limit of %d bytes", maxSize)
+	}
+
+	return content, nil
+}
@@ -0,0 +1,95 @@
+package k6exec
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_analyze_remote(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		switch r.URL.Path {
+		case "/script.js":
+			_, _ = w.Write([]byte(`"use k6 with k6/x/faker > 0.4.0";` + "\nexport default function() {}\n"))
+		case "/auth.js":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			_, _ = w.Write([]byte(`import sql from "k6/x/sql";`))
+		case "/large.js":
+			_, _ = w.Write([]byte(strings.Repeat("//", 1024)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	t.Cleanup(srv.Close)
+
+	opts := &Options{
+		Env:      k6deps.Source{Ignore: true},
+		Manifest: k6deps.Source{Ignore: true},
+	}
+
+	analyzeURL := func(path string, opts *Options) (k6deps.Dependencies, error) {
+		args, err := ParseArgs([]string{"run", srv.URL + path})
+		require.NoError(t, err)
+
+		analysis, err := analyze(context.Background(), args, nil, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return analysis.Dependencies, nil
+	}
+
+	deps, err := analyzeURL("/script.js", opts)
+	require.NoError(t, err)
+	require.Contains(t, deps, "k6/x/faker")
+
+	// the second analysis must use the cached content
+	deps, err = analyzeURL("/script.js", opts)
+	require.NoError(t, err)
+	require.Contains(t, deps, "k6/x/faker")
+	require.Equal(t, int32(1), requests.Load())
+
+	_, err = analyzeURL("/auth.js", opts)
+	require.ErrorIs(t, err, ErrRemoteScript)
+
+	deps, err = analyzeURL("/auth.js", &Options{
+		Env:        k6deps.Source{Ignore: true},
+		Manifest:   k6deps.Source{Ignore: true},
+		RemoteAuth: "Bearer secret",
+	})
+	require.NoError(t, err)
+	require.Contains(t, deps, "k6/x/sql")
+
+	// the content fetched with credentials is not returned to callers without them
+	_, err = analyzeURL("/auth.js", opts)
+	require.ErrorIs(t, err, ErrRemoteScript)
+	require.ErrorContains(t, err, "401")
+
+	_, err = analyzeURL("/large.js", &Options{
+		Env:           k6deps.Source{Ignore: true},
+		Manifest:      k6deps.Source{Ignore: true},
+		RemoteMaxSize: 1024,
+	})
+	require.ErrorIs(t, err, ErrRemoteScript)
+
+	_, err = analyzeURL("/no_such_script.js", opts)
+	require.ErrorIs(t, err, ErrRemoteScript)
+}
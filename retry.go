@@ -0,0 +1,150 @@
+package k6exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/grafana/k6deps"
+)
+
+const (
+	defaultRetries          = 3
+	defaultRetryBackoff     = time.Second
+	maxRetryBackoff         = 30 * time.Second
+	defaultProvisionTimeout = 10 * time.Minute
+)
+
+var (
+	// ErrProvisionTimeout is returned when the k6 executable cannot be provisioned within Options.ProvisionTimeout.
+	ErrProvisionTimeout = errors.New("provisioning timeout")
+	// ErrBuildServiceUnavailable is returned when the build service cannot be reached
+	// or it responds with transient errors, even after retries.
+	ErrBuildServiceUnavailable = errors.New("build service unavailable")
+)
+
+// retryProvisioner retries provisioning with exponential backoff and jitter (or waiting as requested by
+// the Retry-After header), if the build service responds with a transient error or it cannot be reached.
+// If the wait would exceed the deadline of provisioning, it fails without waiting.
+type retryProvisioner struct {
+	provisioner Provisioner
+	retries     int
+	backoff     time.Duration
+	timeout     time.Duration
+}
+
+func newRetryProvisioner(provisioner Provisioner, opts *Options) *retryProvisioner {
+	p := &retryProvisioner{
+		provisioner: provisioner,
+		retries:     max(opts.Retries, 0),
+		backoff:     opts.RetryBackoff,
+		timeout:     opts.ProvisionTimeout,
+	}
+
+	if opts.Retries == 0 {
+		p.retries = defaultRetries
+	}
+
+	if p.backoff == 0 {
+		p.backoff = defaultRetryBackoff
+	}
+
+	if p.timeout == 0 {
+		p.timeout = defaultProvisionTimeout
+	}
+
+	return p
+}
+
+func (p *retryProvisioner) Provision(ctx context.Context, deps k6deps.Dependencies) (*Binary, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	backoff := p.backoff
+
+	for attempt := 1; ; attempt++ {
+		slog.Debug("provisioning attempt", "attempt", attempt)
+
+		binary, err := p.provisioner.Provision(ctx, deps)
+		if err == nil {
+			return binary, nil
+		}
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: %w: %s: %w", ErrBuildServiceUnavailable, ErrProvisionTimeout, p.timeout, err)
+		}
+
+		switch {
+		case !isTransientError(err):
+			return nil, err
+		case attempt > p.retries:
+			return nil, fmt.Errorf("%w: %w", ErrBuildServiceUnavailable, err)
+		}
+
+		// the wait requested by the build service takes precedence over the backoff
+		wait := retryAfter(err)
+		if wait == 0 {
+			wait = backoff/2 + rand.N(backoff/2+1) //nolint:gosec,mnd
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return nil, fmt.Errorf("%w: %w: %s: %w", ErrBuildServiceUnavailable, ErrProvisionTimeout, p.timeout, err)
+		}
+
+		slog.Debug("provisioning attempt failed, retrying", "attempt", attempt, "wait", wait, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+
+		backoff = min(backoff*2, maxRetryBackoff) //nolint:mnd
+	}
+}
+
+// isTransientError returns whether the error of the build service (or the download of the k6 executable)
+// is caused by the build service (or the download server) being unreachable or responding with a transient status.
+func isTransientError(err error) bool {
+	if !errors.Is(err, ErrBuildService) || errors.Is(err, ErrInvalidDependencies) {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *statusError
+
+	if errors.As(err, &statusErr) {
+		switch statusErr.code {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryAfter returns the wait requested by the build service (or the download server) in the error, if any.
+func retryAfter(err error) time.Duration {
+	var statusErr *statusError
+
+	if errors.As(err, &statusErr) {
+		return statusErr.retryAfter
+	}
+
+	return 0
+}
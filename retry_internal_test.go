@@ -0,0 +1,271 @@
+package k6exec
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/grafana/k6deps"
+	"github.com/stretchr/testify/require"
+)
+
+// httpProvisioner is a stand-in of the build service provisioner, sending a request to the given URL.
+// Like the build service client, it reports the failures as build service errors.
+type httpProvisioner struct {
+	url string
+}
+
+func (p *httpProvisioner) Provision(ctx context.Context, _ k6deps.Dependencies) (*Binary, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBuildService, err)
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %w", ErrBuildService, newStatusError(resp))
+	}
+
+	return &Binary{Path: "k6"}, nil
+}
+
+// flakyServer fails with the given statuses before succeeding, returning the number of requests.
+func flakyServer(t *testing.T, statuses ...int) (string, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		idx := int(requests.Add(1)) - 1
+		if idx >= len(statuses) {
+			return
+		}
+
+		w.WriteHeader(statuses[idx])
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv.URL, &requests
+}
+
+func Test_retryProvisioner(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{RetryBackoff: time.Millisecond}
+
+	t.Run("transient errors", func(t *testing.T) {
+		t.Parallel()
+
+		url, requests := flakyServer(t, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+		binary, err := newRetryProvisioner(&httpProvisioner{url: url}, opts).Provision(context.Background(), nil)
+		require.NoError(t, err)
+		require.Equal(t, "k6", binary.Path)
+		require.Equal(t, int32(4), requests.Load())
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		t.Parallel()
+
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+
+		_, err := newRetryProvisioner(&httpProvisioner{url: srv.URL}, &Options{RetryBackoff: time.Millisecond, Retries: 1}).
+			Provision(context.Background(), nil)
+		require.ErrorIs(t, err, ErrBuildServiceUnavailable)
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		t.Parallel()
+
+		url, requests := flakyServer(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+
+		_, err := newRetryProvisioner(&httpProvisioner{url: url}, &Options{RetryBackoff: time.Millisecond, Retries: 1}).
+			Provision(context.Background(), nil)
+		require.ErrorIs(t, err, ErrBuildServiceUnavailable)
+		require.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("retries disabled", func(t *testing.T) {
+		t.Parallel()
+
+		url, requests := flakyServer(t, http.StatusBadGateway)
+
+		_, err := newRetryProvisioner(&httpProvisioner{url: url}, &Options{Retries: -1}).Provision(context.Background(), nil)
+		require.Error(t, err)
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("permanent error", func(t *testing.T) {
+		t.Parallel()
+
+		url, requests := flakyServer(t, http.StatusBadRequest)
+
+		_, err := newRetryProvisioner(&httpProvisioner{url: url}, opts).Provision(context.Background(), nil)
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrBuildServiceUnavailable)
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		t.Parallel()
+
+		url, requests := flakyServer(t, http.StatusServiceUnavailable)
+
+		opts := &Options{RetryBackoff: time.Minute, ProvisionTimeout: time.Second}
+
+		_, err := newRetryProvisioner(&httpProvisioner{url: url}, opts).Provision(context.Background(), nil)
+		require.ErrorIs(t, err, ErrProvisionTimeout)
+		require.Equal(t, int32(1), requests.Load())
+	})
+}
+
+func Test_isTransientError(t *testing.T) {
+	t.Parallel()
+
+	refused := &url.Error{Op: "Post", URL: "http://localhost", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}
+
+	for _, err := range []error{
+		fmt.Errorf("%w: %w", ErrBuildService, refused),
+		fmt.Errorf("%w: %w", ErrBuildService, io.ErrUnexpectedEOF),
+		fmt.Errorf("%w: %w", ErrBuildService, &statusError{status: "503 Service Unavailable", code: 503}),
+		fmt.Errorf("%w: downloading k6 binary: %w", ErrBuildService, &statusError{status: "429 Too Many Requests", code: 429}),
+	} {
+		require.True(t, isTransientError(err), err.Error())
+	}
+
+	for _, err := range []error{
+		refused,
+		fmt.Errorf("%w: %w", ErrBuildService, &statusError{status: "400 Bad Request", code: 400}),
+		// the status is not looked for in the message
+		fmt.Errorf("%w: status 503 Service Unavailable", ErrBuildService),
+		fmt.Errorf("%w: %w: %w", ErrBuildService, ErrInvalidDependencies, &statusError{status: "503", code: 503}),
+		fmt.Errorf("%w: %w", ErrBuildService, &url.Error{Op: "Post", URL: "http://localhost", Err: context.Canceled}),
+	} {
+		require.False(t, isTransientError(err), err.Error())
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for value, expected := range map[string]time.Duration{
+		"":                              0,
+		"1":                             time.Second,
+		" 120 ":                         2 * time.Minute,
+		"-1":                            0,
+		"soon":                          0,
+		"Sat, 01 Mar 2025 12:00:30 GMT": 30 * time.Second,
+		"Sat, 01 Mar 2025 11:00:00 GMT": 0,
+	} {
+		require.Equal(t, expected, parseRetryAfter(value, now), value)
+	}
+}
+
+func Test_retryProvisioner_retryAfter(t *testing.T) {
+	t.Parallel()
+
+	svc := newBuildService(t, nil)
+
+	var requests atomic.Int32
+
+	// the build service asks to retry the first request after a second
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		svc.Config.Handler.ServeHTTP(w, r)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	k6, err := k6deps.NewDependency(k6deps.NameK6, k6deps.ConstraintsAny)
+	require.NoError(t, err)
+
+	deps := k6deps.Dependencies{k6deps.NameK6: k6}
+
+	opts := &Options{
+		BuildServiceURL: srv.URL,
+		RetryBackoff:    time.Millisecond,
+		CacheDir:        t.TempDir(),
+		BinaryCacheDir:  t.TempDir(),
+	}
+
+	start := time.Now()
+
+	binary, err := newBuildServiceProvisioner(opts, hostPlatform()).Provision(context.Background(), deps)
+	require.NoError(t, err)
+	require.FileExists(t, binary.Path)
+	require.GreaterOrEqual(t, time.Since(start), time.Second)
+	require.Equal(t, int32(2), requests.Load())
+
+	// a wait beyond the deadline fails without waiting
+	requests.Store(0)
+
+	opts.ProvisionTimeout = 500 * time.Millisecond
+	start = time.Now()
+
+	_, err = newBuildServiceProvisioner(opts, hostPlatform()).Provision(context.Background(), deps)
+	require.ErrorIs(t, err, ErrProvisionTimeout)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.Equal(t, int32(1), requests.Load())
+}
+
+func Test_buildServiceProvisioner_retry(t *testing.T) {
+	t.Parallel()
+
+	svc := newBuildService(t, nil)
+
+	var requests atomic.Int32
+
+	// the build service is unavailable for the first request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		svc.Config.Handler.ServeHTTP(w, r)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	k6, err := k6deps.NewDependency(k6deps.NameK6, k6deps.ConstraintsAny)
+	require.NoError(t, err)
+
+	opts := &Options{
+		BuildServiceURL: srv.URL,
+		RetryBackoff:    time.Millisecond,
+		CacheDir:        t.TempDir(),
+		BinaryCacheDir:  t.TempDir(),
+	}
+
+	binary, err := newBuildServiceProvisioner(opts, hostPlatform()).
+		Provision(context.Background(), k6deps.Dependencies{k6deps.NameK6: k6})
+	require.NoError(t, err)
+	require.FileExists(t, binary.Path)
+	require.Equal(t, int32(2), requests.Load())
+	require.Equal(t, int32(1), svc.builds.Load())
+}
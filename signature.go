@@ -0,0 +1,188 @@
+package k6exec
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// signatureSuffix is appended to the path (and the download URL) of the k6 executable
+// to get its detached signature.
+const signatureSuffix = ".sig"
+
+// ErrSignature is returned when the signature of the provisioned k6 executable cannot be verified.
+var ErrSignature = errors.New("signature verification error")
+
+// verifySignature verifies that the k6 executable is signed by one of the trusted keys.
+// The detached signature is the ed25519 signature of the hex encoded SHA-256 checksum of the k6 executable.
+// It is downloaded next to the k6 executable, or it is fetched using the download URL of the k6 executable.
+func verifySignature(
+	ctx context.Context,
+	binary *Binary,
+	downloadURL string,
+	keys []ed25519.PublicKey,
+	opts *Options,
+) error {
+	sum, err := checksum(binary.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrSignature, err.Error())
+	}
+
+	if len(binary.Checksum) > 0 && sum != binary.Checksum {
+		return fmt.Errorf("%w: %s: checksum %s differs from the expected checksum %s",
+			ErrSignature, binary.Path, sum, binary.Checksum)
+	}
+
+	signature, err := loadSignature(ctx, binary.Path, downloadURL, opts)
+	if err != nil {
+		return fmt.Errorf("%w: %s: missing signature: %s", ErrSignature, binary.Path, err.Error())
+	}
+
+	for _, key := range keys {
+		if len(key) == ed25519.PublicKeySize && ed25519.Verify(key, []byte(sum), signature) {
+			slog.Debug("signature verified", "path", binary.Path, "checksum", sum)
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s: not signed by a trusted key", ErrSignature, binary.Path)
+}
+
+// verifyBinary verifies the provisioned k6 executable, if it has trusted keys. A locally built k6 executable
+// is not signed: if it was built earlier, its checksum must match the one recorded when it was built.
+// Any other k6 executable must be signed by one of its trusted keys.
+func verifyBinary(ctx context.Context, binary *Binary, opts *Options) error {
+	if len(binary.trustedKeys) == 0 {
+		return nil
+	}
+
+	local, err := isLocalBuild(binary.Path, opts)
+	if err != nil {
+		return err
+	}
+
+	if !local {
+		return verifySignature(ctx, binary, binary.downloadURL, binary.trustedKeys, opts)
+	}
+
+	if !binary.Cached {
+		return nil
+	}
+
+	index, err := loadBinaryIndex(opts)
+	if err != nil {
+		return err
+	}
+
+	cached := index.lookup(binary.Path)
+	if cached == nil || len(cached.Checksum) == 0 {
+		return fmt.Errorf("%w: %s: the checksum of the local build is not recorded", ErrSignature, binary.Path)
+	}
+
+	sum, err := checksum(binary.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrSignature, err.Error())
+	}
+
+	if sum != cached.Checksum {
+		return fmt.Errorf("%w: %s: checksum %s differs from the checksum %s recorded when it was built",
+			ErrSignature, binary.Path, sum, cached.Checksum)
+	}
+
+	return nil
+}
+
+// isLocalBuild returns whether the k6 executable is in the directory of the local builds.
+func isLocalBuild(path string, opts *Options) (bool, error) {
+	dir, err := cacheDir(opts)
+	if err != nil {
+		return false, err
+	}
+
+	rel, err := filepath.Rel(filepath.Join(dir, localBuildsDir), path)
+
+	return err == nil && filepath.IsLocal(rel), nil
+}
+
+// loadSignature returns the detached signature of the k6 executable, downloading (and storing) it if needed.
+func loadSignature(ctx context.Context, path string, downloadURL string, opts *Options) ([]byte, error) {
+	data, err := os.ReadFile(path + signatureSuffix)            //nolint:forbidigo
+	if errors.Is(err, os.ErrNotExist) && len(downloadURL) > 0 { //nolint:forbidigo
+		data, err = downloadSignature(ctx, downloadURL, opts)
+		if err == nil {
+			if werr := os.WriteFile(path+signatureSuffix, data, 0o600); werr != nil { //nolint:forbidigo,mnd
+				slog.Debug("signature not stored", "error", werr)
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSignature(data)
+}
+
+func downloadSignature(ctx context.Context, downloadURL string, opts *Options) ([]byte, error) {
+	sigURL, err := url.Parse(downloadURL)
+	if err != nil {
+		return nil, err
+	}
+
+	sigURL.Path += signatureSuffix
+	sigURL.RawPath = ""
+
+	// a presigned download URL authorizes only the download of the k6 executable: the query string
+	// is dropped, and the download credentials are not sent to the storage presigning the URL
+	var header http.Header
+
+	if len(sigURL.RawQuery) == 0 {
+		header = downloadHeader(opts)
+	}
+
+	sigURL.RawQuery = ""
+
+	return download(ctx, "fetching k6 binary signature", sigURL.String(), header, opts)
+}
+
+// downloadHeader returns the header used to download the k6 executable (and its signature).
+func downloadHeader(opts *Options) http.Header {
+	auth := opts.DownloadAuth
+	if len(auth) == 0 {
+		auth = os.Getenv("K6_DOWNLOAD_AUTH") //nolint:forbidigo
+	}
+
+	header := authHeader(auth)
+	if header == nil && len(opts.DownloadHeaders) > 0 {
+		header = make(http.Header, len(opts.DownloadHeaders))
+	}
+
+	for name, value := range opts.DownloadHeaders {
+		header.Set(name, value)
+	}
+
+	return header
+}
+
+// decodeSignature decodes the signature, which is either raw or base64 encoded.
+func decodeSignature(data []byte) ([]byte, error) {
+	if len(data) == ed25519.SignatureSize {
+		return data, nil
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return nil, errors.New("invalid signature format")
+	}
+
+	return signature, nil
+}
@@ -0,0 +1,229 @@
+package k6exec
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/k6exec/internal/k6exectest"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_verifySignature(t *testing.T) {
+	t.Parallel()
+
+	trusted, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	untrusted, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+
+	binary := &Binary{Path: filepath.Join(dir, "k6")}
+
+	require.NoError(t, os.WriteFile(binary.Path, []byte("k6"), 0o700)) //nolint:forbidigo
+
+	binary.Checksum, err = checksum(binary.Path)
+	require.NoError(t, err)
+
+	signature := ed25519.Sign(key, []byte(binary.Checksum))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the signature of a presigned download URL is fetched without the query string and the credentials
+		if r.URL.Path == "/k6.sig" && (len(r.URL.RawQuery) > 0 || len(r.Header.Get("Authorization")) > 0) {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		if r.URL.Path == "/private/k6.sig" &&
+			(r.Header.Get("Authorization") != "Bearer download" || r.Header.Get("X-Api-Key") != "secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		if r.URL.Path != "/k6.sig" && r.URL.Path != "/private/k6.sig" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(signature)))
+	}))
+
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	opts := new(Options)
+	keys := []ed25519.PublicKey{untrusted, trusted}
+
+	// missing signature
+	err = verifySignature(ctx, binary, srv.URL+"/other?token=secret", keys, opts)
+	require.ErrorIs(t, err, ErrSignature)
+
+	err = verifySignature(ctx, binary, "", keys, opts)
+	require.ErrorIs(t, err, ErrSignature)
+
+	// the signature is downloaded and stored next to the binary
+	presigned := &Options{DownloadAuth: "Bearer download"}
+
+	require.NoError(t, verifySignature(ctx, binary, srv.URL+"/k6?token=secret", keys, presigned))
+	require.FileExists(t, binary.Path+signatureSuffix)
+	require.NoError(t, verifySignature(ctx, binary, "", keys, opts))
+
+	// untrusted key
+	err = verifySignature(ctx, binary, "", []ed25519.PublicKey{untrusted}, opts)
+	require.ErrorIs(t, err, ErrSignature)
+
+	// raw signature
+	require.NoError(t, os.WriteFile(binary.Path+signatureSuffix, signature, 0o600)) //nolint:forbidigo
+	require.NoError(t, verifySignature(ctx, binary, "", keys, opts))
+
+	// tampered binary
+	require.NoError(t, os.WriteFile(binary.Path, []byte("tampered"), 0o700)) //nolint:forbidigo
+
+	err = verifySignature(ctx, binary, "", keys, opts)
+	require.ErrorIs(t, err, ErrSignature)
+
+	tampered := &Binary{Path: binary.Path}
+
+	err = verifySignature(ctx, tampered, "", keys, opts)
+	require.ErrorIs(t, err, ErrSignature)
+
+	// the signature is downloaded with the download credentials
+	require.NoError(t, os.WriteFile(binary.Path, []byte("k6"), 0o700)) //nolint:forbidigo
+	require.NoError(t, os.Remove(binary.Path+signatureSuffix))         //nolint:forbidigo
+
+	err = verifySignature(ctx, binary, srv.URL+"/private/k6", keys, opts)
+	require.ErrorIs(t, err, ErrSignature)
+
+	opts = &Options{DownloadAuth: "Bearer download", DownloadHeaders: map[string]string{"X-Api-Key": "secret"}}
+
+	require.NoError(t, verifySignature(ctx, binary, srv.URL+"/private/k6", keys, opts))
+}
+
+func Test_downloadHeader(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, downloadHeader(&Options{}))
+	require.Equal(t, http.Header{"Authorization": {"token"}}, downloadHeader(&Options{DownloadAuth: "token"}))
+	require.Equal(t,
+		http.Header{"X-Api-Key": {"secret"}},
+		downloadHeader(&Options{DownloadHeaders: map[string]string{"x-api-key": "secret"}}),
+	)
+}
+
+func Test_verifyBinary(t *testing.T) {
+	t.Parallel()
+
+	trusted, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	opts := &Options{CacheDir: t.TempDir(), TrustedKeys: []ed25519.PublicKey{trusted}}
+	ctx := context.Background()
+
+	// downloaded binary
+	binary := &Binary{Path: filepath.Join(t.TempDir(), "k6"), trustedKeys: opts.TrustedKeys}
+
+	require.NoError(t, os.WriteFile(binary.Path, []byte("k6"), 0o700)) //nolint:forbidigo
+
+	require.ErrorIs(t, verifyBinary(ctx, binary, opts), ErrSignature)
+	require.NoError(t, verifyBinary(ctx, &Binary{Path: binary.Path}, opts))
+
+	sum, err := checksum(binary.Path)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(binary.Path+signatureSuffix, ed25519.Sign(key, []byte(sum)), 0o600)) //nolint:forbidigo
+	require.NoError(t, verifyBinary(ctx, binary, opts))
+
+	// local build
+	local := &Binary{
+		Path:        filepath.Join(opts.CacheDir, localBuildsDir, "id", "k6"),
+		Checksum:    sum,
+		trustedKeys: opts.TrustedKeys,
+	}
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(local.Path), 0o700))  //nolint:forbidigo
+	require.NoError(t, os.WriteFile(local.Path, []byte("k6"), 0o700)) //nolint:forbidigo
+
+	// built now
+	require.NoError(t, verifyBinary(ctx, local, opts))
+
+	// built earlier, but not recorded
+	local.Cached = true
+
+	require.ErrorIs(t, verifyBinary(ctx, local, opts), ErrSignature)
+
+	recordBinary(local, "linux/amd64", opts)
+	require.NoError(t, verifyBinary(ctx, local, opts))
+
+	require.NoError(t, os.WriteFile(local.Path, []byte("tampered"), 0o700)) //nolint:forbidigo
+	require.ErrorIs(t, verifyBinary(ctx, local, opts), ErrSignature)
+}
+
+func Test_buildServices_trustedKeys(t *testing.T) {
+	t.Parallel()
+
+	common, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	own, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	opts := &Options{
+		BuildServices: []BuildService{
+			{URL: "https://one.example.com", TrustedKeys: []ed25519.PublicKey{own}},
+			{URL: "https://two.example.com"},
+		},
+		TrustedKeys: []ed25519.PublicKey{common},
+	}
+
+	services := buildServices(opts)
+
+	require.Equal(t, []ed25519.PublicKey{own, common}, services[0].TrustedKeys)
+	require.Equal(t, []ed25519.PublicKey{common}, services[1].TrustedKeys)
+	require.Equal(t, []ed25519.PublicKey{own}, opts.BuildServices[0].TrustedKeys)
+	require.Len(t, allTrustedKeys(opts), 3)
+}
+
+func Test_signature_provisioners(t *testing.T) {
+	t.Parallel()
+
+	trusted, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	opts := &Options{CacheDir: t.TempDir()}
+	unsigned := &Binary{Path: filepath.Join(t.TempDir(), "k6"), trustedKeys: []ed25519.PublicKey{trusted}}
+
+	require.NoError(t, os.WriteFile(unsigned.Path, []byte("k6"), 0o700)) //nolint:forbidigo
+
+	// the unsigned binary is refused and not recorded
+	recording := &recordingProvisioner{
+		provisioner: &k6exectest.Provisioner[*Binary]{Binary: unsigned},
+		opts:        opts,
+		platform:    "linux/amd64",
+	}
+
+	_, err = recording.Provision(context.Background(), nil)
+	require.ErrorIs(t, err, ErrSignature)
+
+	index, err := loadBinaryIndex(opts)
+	require.NoError(t, err)
+	require.Nil(t, index.lookup(unsigned.Path))
+
+	// no fallback after a signature error
+	next := &k6exectest.Provisioner[*Binary]{Binary: &Binary{Path: "k6"}}
+
+	failing := &k6exectest.Provisioner[*Binary]{Err: ErrSignature}
+
+	_, err = fallbackProvisioner{failing, next}.Provision(context.Background(), nil)
+	require.ErrorIs(t, err, ErrSignature)
+	require.Zero(t, next.Calls())
+}
@@ -0,0 +1,142 @@
+package k6exec
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/grafana/k6deps"
+)
+
+// sniffLen is the number of bytes needed to detect the type of the content.
+const sniffLen = 512
+
+// isArchive returns true if the content starts with a tar header, as created by the k6 archive command.
+func isArchive(head []byte) bool {
+	const (
+		magicOffset = 257
+		magic       = "ustar"
+	)
+
+	return len(head) >= magicOffset+len(magic) && string(head[magicOffset:magicOffset+len(magic)]) == magic
+}
+
+// isGzip returns true if the content starts with the gzip magic number.
+func isGzip(head []byte) bool {
+	return len(head) >= 2 && head[0] == 0x1f && head[1] == 0x8b
+}
+
+// sniff detects whether the content read from input is a k6 archive (tar) or a script (JavaScript or TypeScript).
+// Gzip-compressed content is transparently decompressed.
+// It returns a reader for the (decompressed) content, and whether the content is an archive and was compressed.
+func sniff(input io.Reader) (io.Reader, bool, bool, error) {
+	buffered := bufio.NewReaderSize(input, sniffLen)
+
+	head, err := peek(buffered)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	if !isGzip(head) {
+		return buffered, isArchive(head), false, nil
+	}
+
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	decompressed := bufio.NewReaderSize(gz, sniffLen)
+
+	head, err = peek(decompressed)
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	return decompressed, isArchive(head), true, nil
+}
+
+// peek returns the first bytes of the content, fewer if the content is shorter.
+func peek(input *bufio.Reader) ([]byte, error) {
+	head, err := input.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return head, nil
+}
+
+// setContent sets the script or the archive source from content that is not read from a local file.
+func setContent(dopts *k6deps.Options, name string, content []byte) error {
+	input, archive, _, err := sniff(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	if archive {
+		dopts.Archive.Name = name
+		dopts.Archive.Reader = input
+
+		return nil
+	}
+
+	if content, err = io.ReadAll(input); err != nil {
+		return err
+	}
+
+	dopts.Script.Name = name
+	dopts.Script.Contents = content
+
+	return nil
+}
+
+// setFile sets the script or the archive source from a local file, based on its content.
+// The returned function must be called to release the file after the analysis.
+func setFile(dopts *k6deps.Options, filename string) (func() error, error) {
+	file, err := os.Open(filename) //nolint:forbidigo,gosec
+	if err != nil {
+		return nil, err
+	}
+
+	input, archive, compressed, err := sniff(file)
+
+	switch {
+	case err != nil:
+		_ = file.Close()
+
+		return nil, err
+	case !compressed:
+		// uncompressed sources are read again by name, so scripts can be bundled with their local imports
+		if archive {
+			dopts.Archive.Name = filename
+		} else {
+			dopts.Script.Name = filename
+		}
+
+		return nopCloser, file.Close()
+	case archive:
+		dopts.Archive.Name = filename
+		dopts.Archive.Reader = input
+
+		return file.Close, nil
+	}
+
+	defer file.Close() //nolint:errcheck
+
+	content, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	dopts.Script.Name = filename
+	dopts.Script.Contents = content
+
+	return nopCloser, nil
+}
+
+func nopCloser() error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package k6exec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, content []byte) []byte {
+	t.Helper()
+
+	var buff bytes.Buffer
+
+	writer := gzip.NewWriter(&buff)
+
+	_, err := writer.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	return buff.Bytes()
+}
+
+func Test_isArchive(t *testing.T) {
+	t.Parallel()
+
+	archive, err := os.ReadFile(filepath.Join("cmd", "testdata", "archive.tar")) //nolint:forbidigo
+	require.NoError(t, err)
+
+	require.True(t, isArchive(archive))
+	require.False(t, isArchive([]byte("export default function() {}")))
+	require.False(t, isArchive(nil))
+}
+
+func Test_analyze_sniff(t *testing.T) {
+	t.Parallel()
+
+	archive, err := os.ReadFile(filepath.Join("cmd", "testdata", "archive.tar")) //nolint:forbidigo
+	require.NoError(t, err)
+
+	script := []byte(`"use k6 with k6/x/faker > 0.4.0";` + "\nexport default function() {}\n")
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		content  []byte
+		expected []string
+	}{
+		{name: "archive.k6", content: archive, expected: []string{"k6/x/faker", "k6/x/sql"}},
+		{name: "archive", content: archive, expected: []string{"k6/x/faker", "k6/x/sql"}},
+		{name: "archive.tar.gz", content: gzipped(t, archive), expected: []string{"k6/x/faker", "k6/x/sql"}},
+		{name: "archive.bin", content: gzipped(t, archive), expected: []string{"k6/x/faker", "k6/x/sql"}},
+		{name: "script", content: script, expected: []string{"k6/x/faker"}},
+		{name: "script.ts", content: script, expected: []string{"k6/x/faker"}},
+		{name: "script.js.gz", content: gzipped(t, script), expected: []string{"k6/x/faker"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			filename := filepath.Join(dir, tt.name)
+
+			require.NoError(t, os.WriteFile(filename, tt.content, 0o600)) //nolint:forbidigo
+
+			opts := &Options{
+				Env:      k6deps.Source{Ignore: true},
+				Manifest: k6deps.Source{Ignore: true},
+			}
+
+			for _, script := range []string{filename, StdinScript} {
+				args, err := ParseArgs([]string{"run", script})
+				require.NoError(t, err)
+
+				analysis, err := analyze(context.Background(), args, tt.content, opts)
+				require.NoError(t, err)
+
+				for _, name := range tt.expected {
+					require.Contains(t, analysis.Dependencies, name)
+				}
+			}
+		})
+	}
+}
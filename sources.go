@@ -0,0 +1,174 @@
+package k6exec
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/grafana/k6deps"
+)
+
+// originScript is the origin of the whole script, which is split into pragmas and imports per dependency.
+const originScript Origin = "script"
+
+// sourceDependencies contains the dependencies found in a single source.
+type sourceDependencies struct {
+	origin Origin
+	name   string
+	deps   k6deps.Dependencies
+	// pragmas and imports contain the dependencies found by the pragmas and the imports of a script
+	pragmas k6deps.Dependencies
+	imports k6deps.Dependencies
+}
+
+//nolint:gochecknoglobals
+var (
+	// hidePragmas hides the "use k6" pragmas of a script from k6deps: no import starts with "use.
+	hidePragmas = strings.NewReplacer(`"use`, `"-use`)
+	// hideImports hides the imports and the require calls of a script from k6deps.
+	hideImports = strings.NewReplacer("import ", "import-", "require(", "require-(")
+)
+
+// analyzeSources analyzes each dependency source separately, in the order in which k6deps.Analyze merges them.
+// The resolved sources (e.g. the manifest file found, the loaded script) are set back in dopts.
+func analyzeSources(dopts *k6deps.Options) ([]*sourceDependencies, error) {
+	ignore := k6deps.Source{Ignore: true}
+
+	if !dopts.Archive.Ignore && !dopts.Archive.IsEmpty() {
+		deps, err := k6deps.Analyze(&k6deps.Options{Archive: dopts.Archive})
+		if err != nil {
+			return nil, err
+		}
+
+		return []*sourceDependencies{{origin: OriginArchive, name: dopts.Archive.Name, deps: deps}}, nil
+	}
+
+	if !dopts.Manifest.Ignore && dopts.Manifest.IsEmpty() && dopts.FindManifest != nil {
+		if err := findManifest(dopts); err != nil {
+			return nil, err
+		}
+	}
+
+	sources := make([]*sourceDependencies, 0, 3)
+
+	if !dopts.Script.Ignore && !dopts.Script.IsEmpty() {
+		sopts := &k6deps.Options{Script: dopts.Script, Manifest: ignore, Env: ignore}
+
+		deps, err := k6deps.Analyze(sopts)
+		if err != nil {
+			return nil, err
+		}
+
+		dopts.Script = sopts.Script
+
+		src := &sourceDependencies{origin: originScript, name: sopts.Script.Name, deps: deps}
+		if err := src.splitScript(sopts.Script.Contents); err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, src)
+	}
+
+	if !dopts.Manifest.Ignore {
+		// without a manifest, k6deps looks for the one closest to the script (the name is enough for that),
+		// the contents of the script are analyzed separately
+		mopts := &k6deps.Options{
+			Manifest: dopts.Manifest,
+			Script:   k6deps.Source{Name: manifestSearchStart(dopts), Reader: bytes.NewReader(nil), Ignore: true},
+			Env:      ignore,
+		}
+
+		deps, err := k6deps.Analyze(mopts)
+		if err != nil {
+			return nil, err
+		}
+
+		dopts.Manifest = mopts.Manifest
+
+		if !dopts.Manifest.IsEmpty() {
+			sources = append(sources, &sourceDependencies{origin: OriginManifest, name: dopts.Manifest.Name, deps: deps})
+		}
+	}
+
+	if !dopts.Env.Ignore {
+		eopts := &k6deps.Options{Env: dopts.Env, LookupEnv: dopts.LookupEnv, Manifest: ignore}
+
+		deps, err := k6deps.Analyze(eopts)
+		if err != nil {
+			return nil, err
+		}
+
+		dopts.Env = eopts.Env
+
+		if len(deps) > 0 {
+			sources = append(sources, &sourceDependencies{origin: OriginEnv, name: eopts.Env.Name, deps: deps})
+		}
+	}
+
+	return sources, nil
+}
+
+// splitScript tells the dependencies found in the pragmas of the (bundled) script from those found in its imports.
+// The script is analyzed by k6deps again, once with the imports hidden and once with the pragmas hidden,
+// so the dependencies are found the same way as when the whole script is analyzed.
+func (src *sourceDependencies) splitScript(contents []byte) error {
+	if err := src.pragmas.UnmarshalJS([]byte(hideImports.Replace(string(contents)))); err != nil {
+		return err
+	}
+
+	return src.imports.UnmarshalJS([]byte(hidePragmas.Replace(string(contents))))
+}
+
+// dependencySources returns the sources of the dependencies, indexed by dependency name.
+func (src *sourceDependencies) dependencySources() map[string][]DependencySource {
+	found := make(map[string][]DependencySource, len(src.deps))
+
+	for name, dep := range src.deps {
+		if src.origin != originScript {
+			found[name] = []DependencySource{{Origin: src.origin, Name: src.name, Constraints: dep.GetConstraints().String()}}
+
+			continue
+		}
+
+		if pragma, ok := src.pragmas[name]; ok {
+			found[name] = append(found[name], DependencySource{
+				Origin:      OriginPragma,
+				Name:        src.name,
+				Constraints: pragma.GetConstraints().String(),
+			})
+		}
+
+		if _, ok := src.imports[name]; ok || len(found[name]) == 0 {
+			found[name] = append(found[name], DependencySource{
+				Origin:      OriginImport,
+				Name:        src.name,
+				Constraints: k6deps.ConstraintsAny,
+			})
+		}
+	}
+
+	return found
+}
+
+// findManifest sets the manifest file found by Options.FindManifest, which k6deps does not use.
+func findManifest(dopts *k6deps.Options) error {
+	filename, found, err := dopts.FindManifest(manifestSearchStart(dopts))
+	if err != nil {
+		return err
+	}
+
+	if found {
+		dopts.Manifest.Name = filename
+	}
+
+	return nil
+}
+
+// manifestSearchStart returns the file the manifest file is searched for from: the script,
+// or none (the current directory) if the script is read from the standard input or it is remote.
+func manifestSearchStart(dopts *k6deps.Options) string {
+	if dopts.Script.Name == StdinScript || isRemoteScript(dopts.Script.Name) {
+		return ""
+	}
+
+	return dopts.Script.Name
+}
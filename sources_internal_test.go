@@ -0,0 +1,133 @@
+package k6exec
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/grafana/k6deps"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_splitScript(t *testing.T) {
+	t.Parallel()
+
+	for name, tt := range map[string]struct {
+		script  string
+		pragmas string
+		imports string
+	}{
+		"pragma and import": {
+			script:  `"use k6 with k6/x/faker>0.4";` + "\n" + `import faker from "k6/x/faker";`,
+			pragmas: "k6/x/faker>0.4",
+			imports: "k6/x/faker*",
+		},
+		"require": {
+			script:  `const sql = require("k6/x/sql");`,
+			imports: "k6/x/sql*",
+		},
+		"pragma in a string": {
+			script:  `const pragma = "use k6 with k6/x/faker>0.4";`,
+			pragmas: "k6/x/faker>0.4",
+		},
+		"pragma in a comment": {
+			script:  `// "use k6 >0.54"` + "\n" + `import http from "k6/http";`,
+			pragmas: "k6>0.54",
+			imports: "k6*",
+		},
+		"import in a comment": {
+			script:  `// import faker from "k6/x/faker";`,
+			imports: "k6/x/faker*",
+		},
+		"import in an identifier": {
+			script:  `const reimport = 1;` + "\n" + `myrequire("k6/x/sql");` + "\n" + `"use k6 with k6/x/sql>1.0"`,
+			pragmas: "k6/x/sql>1.0",
+			imports: "k6/x/sql*",
+		},
+		"strings starting with use": {
+			script:  `import http from "k6/http"; const headers = {"user-agent": "k6", "used": "import "};`,
+			imports: "k6*",
+		},
+		"import of a module starting with use": {
+			script:  `import use from "k6/x/user";` + "\n" + `"use k6 with k6/x/user>0.1"`,
+			pragmas: "k6/x/user>0.1",
+			imports: "k6/x/user*",
+		},
+		"pragma and import on the same line": {
+			script:  `"use k6 with k6/x/faker>0.4"; import faker from "k6/x/faker"`,
+			pragmas: "k6/x/faker>0.4",
+			imports: "k6/x/faker*",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var whole k6deps.Dependencies
+
+			require.NoError(t, whole.UnmarshalJS([]byte(tt.script)))
+
+			src := &sourceDependencies{origin: originScript, deps: whole}
+
+			require.NoError(t, src.splitScript([]byte(tt.script)))
+			require.Equal(t, tt.pragmas, src.pragmas.String(), "pragmas")
+			require.Equal(t, tt.imports, src.imports.String(), "imports")
+
+			// the split finds the same dependencies as the analysis of the whole script
+			found := maps.Clone(src.imports)
+			maps.Copy(found, src.pragmas)
+
+			require.Equal(t, slices.Sorted(maps.Keys(whole)), slices.Sorted(maps.Keys(found)))
+		})
+	}
+}
+
+func Test_analyzeSources_manifest(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "package.json")
+	script := filepath.Join(dir, "tests", "script.js")
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(script), 0o700))                                       //nolint:forbidigo
+	require.NoError(t, os.WriteFile(script, []byte(`import faker from "k6/x/faker";`), 0o600))         //nolint:forbidigo
+	require.NoError(t, os.WriteFile(manifest, []byte(`{"dependencies":{"k6/x/sql":">=1.0"}}`), 0o600)) //nolint:forbidigo
+
+	ignore := k6deps.Source{Ignore: true}
+
+	// the manifest closest to the script is used
+	dopts := &k6deps.Options{Script: k6deps.Source{Name: script}, Env: ignore}
+
+	sources, err := analyzeSources(dopts)
+	require.NoError(t, err)
+	require.Equal(t, manifest, dopts.Manifest.Name)
+	require.Len(t, sources, 2)
+	require.Equal(t, "k6/x/faker*", sources[0].deps.String())
+	require.Equal(t, OriginManifest, sources[1].origin)
+	require.Equal(t, manifest, sources[1].name)
+	require.Equal(t, "k6/x/sql>=1.0", sources[1].deps.String())
+
+	// the manifest given is used
+	other := filepath.Join(dir, "tests", "package.json")
+
+	require.NoError(t, os.WriteFile(other, []byte(`{"dependencies":{"k6/x/yaml":"*"}}`), 0o600)) //nolint:forbidigo
+
+	dopts = &k6deps.Options{Manifest: k6deps.Source{Name: manifest}, Script: ignore, Env: ignore}
+
+	sources, err = analyzeSources(dopts)
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	require.Equal(t, "k6/x/sql>=1.0", sources[0].deps.String())
+
+	// the manifest found by the function given
+	dopts = &k6deps.Options{
+		Script:       k6deps.Source{Name: script},
+		Env:          ignore,
+		FindManifest: func(string) (string, bool, error) { return manifest, true, nil },
+	}
+
+	_, err = analyzeSources(dopts)
+	require.NoError(t, err)
+	require.Equal(t, manifest, dopts.Manifest.Name)
+}